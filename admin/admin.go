@@ -0,0 +1,283 @@
+package admin
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"cloud_gateway/ratelimit"
+	"cloud_gateway/registry"
+	"cloud_gateway/route"
+	"cloud_gateway/upstream"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build is the version of the gateway together with the build information of
+// the running binary
+type Build struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// NewBuild returns the build information of the running binary for version,
+// the content of the VERSION file
+func NewBuild(version string) Build {
+	build := Build{Version: strings.TrimSpace(version), GoVersion: runtime.Version()}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+// NewEngine returns the engine of the admin api, reporting the config, the
+// routes of rr on every listener and the state of upstreams and rate limiters.
+// It also serves the purge api of the response caches.
+func NewEngine(cfg *config.Config, rr *registry.RouteRegistry, build Build) *gin.Engine {
+	r := gin.Default()
+	r.Use(authenticate(cfg.Admin.Token))
+
+	r.GET("/config", func(c *gin.Context) {
+		redacted, err := redact(cfg)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, redacted)
+	})
+
+	r.GET("/routes", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"routes": routeInfos(rr.Routes), "domain_routes": domainRouteInfos(rr.DomainRoutes)})
+	})
+
+	r.GET("/health", func(c *gin.Context) {
+		balancers := make(map[string]balancerInfo)
+		for name, b := range rr.Balancers {
+			balancers[name] = balancerInfo{HealthChecked: b.HealthChecked(), Targets: b.Status()}
+		}
+		c.JSON(http.StatusOK, gin.H{"balancers": balancers})
+	})
+
+	r.GET("/ratelimiters", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"keys": ratelimit.KeyCounts(rr.RateLimiters)})
+	})
+
+	r.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, build)
+	})
+
+	r.DELETE("/caches", handlers.CachePurgeHandler)
+
+	return r
+}
+
+// authenticate rejects requests that do not carry token as bearer token
+func authenticate(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+const redacted = "[REDACTED]"
+
+// redact returns cfg as reported by the api, without its secrets: the admin
+// token, the values set by headers middleware and the user info of urls
+func redact(cfg *config.Config) (map[string]any, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	if adminCfg, ok := tree["admin"].(map[string]any); ok {
+		adminCfg["token"] = redacted
+	}
+
+	headers, _ := tree["headers"].(map[string]any)
+	for _, headersCfg := range headers {
+		for _, side := range []string{"request", "response"} {
+			rules, _ := mapAt(headersCfg, side)
+			for _, op := range []string{"set", "append"} {
+				values, _ := mapAt(rules, op)
+				for name := range values {
+					values[name] = redacted
+				}
+			}
+		}
+	}
+
+	redactUserInfo(tree)
+	return tree, nil
+}
+
+// mapAt returns the object under key of v when v is an object
+func mapAt(v any, key string) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	nested, ok := m[key].(map[string]any)
+	return nested, ok
+}
+
+// redactUserInfo replaces the user info of every url in v, wherever the config
+// has one: proxy targets, forward auth, mirrors and the like
+func redactUserInfo(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = redactUserInfo(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactUserInfo(value)
+		}
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			u.User = nil
+			return strings.Replace(u.String(), "//", "//"+redacted+"@", 1)
+		}
+	}
+	return v
+}
+
+type balancerInfo struct {
+	HealthChecked bool                    `json:"health_checked"`
+	Targets       []upstream.TargetStatus `json:"targets"`
+}
+
+type routeInfo struct {
+	Method         string                  `json:"method"`
+	Path           string                  `json:"path"`
+	Pattern        string                  `json:"pattern,omitempty"`
+	ProxyTarget    string                  `json:"proxy_target,omitempty"`
+	Targets        []upstream.TargetStatus `json:"targets,omitempty"`
+	RedirectTarget string                  `json:"redirect_target,omitempty"`
+	RedirectCode   int                     `json:"redirect_code,omitempty"`
+	Middleware     []string                `json:"middleware"`
+	Listeners      []string                `json:"listeners"`
+	Conditional    bool                    `json:"conditional"`
+	Mirror         string                  `json:"mirror,omitempty"`
+	WebSocket      bool                    `json:"websocket"`
+	GRPCWeb        bool                    `json:"grpc_web"`
+}
+
+type domainPathInfo struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Middleware []string `json:"middleware"`
+}
+
+type domainRouteInfo struct {
+	Domain      string                  `json:"domain"`
+	ProxyTarget string                  `json:"proxy_target,omitempty"`
+	Targets     []upstream.TargetStatus `json:"targets,omitempty"`
+	Middleware  []string                `json:"middleware"`
+	Paths       []domainPathInfo        `json:"paths"`
+	Listeners   []string                `json:"listeners"`
+	Conditional bool                    `json:"conditional"`
+	WebSocket   bool                    `json:"websocket"`
+	GRPCWeb     bool                    `json:"grpc_web"`
+}
+
+// listeners returns the listeners serving a route, the default one when the
+// route names none
+func listeners(names []string) []string {
+	if len(names) == 0 {
+		return []string{config.DefaultListener}
+	}
+	return names
+}
+
+// emptyIfNil keeps lists without entries from being reported as null
+func emptyIfNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
+func routeInfos(routes []route.Route) []routeInfo {
+	infos := make([]routeInfo, 0, len(routes))
+	for _, rt := range routes {
+		info := routeInfo{
+			Method:         rt.Method,
+			Path:           rt.RelativePath,
+			ProxyTarget:    rt.ProxyTarget,
+			RedirectTarget: rt.RedirectTarget,
+			RedirectCode:   rt.RedirectCode,
+			Middleware:     emptyIfNil(rt.MiddlewareNames),
+			Listeners:      listeners(rt.Listeners),
+			Conditional:    rt.Match != nil,
+			WebSocket:      rt.WebSocket != nil,
+			GRPCWeb:        rt.GRPCWeb,
+		}
+		if rt.Pattern != nil {
+			info.Pattern = rt.Pattern.Raw
+		}
+		if rt.Balancer != nil {
+			info.Targets = rt.Balancer.Status()
+		}
+		if rt.Mirror != nil {
+			info.Mirror = rt.Mirror.Target
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func domainRouteInfos(domainRoutes []route.DomainRoute) []domainRouteInfo {
+	infos := make([]domainRouteInfo, 0, len(domainRoutes))
+	for _, dr := range domainRoutes {
+		paths := make([]domainPathInfo, 0, len(dr.Paths))
+		for _, dp := range dr.Paths {
+			paths = append(paths, domainPathInfo{Method: dp.Method, Path: dp.Path, Middleware: emptyIfNil(dp.MiddlewareNames)})
+		}
+
+		info := domainRouteInfo{
+			Domain:      dr.Domain,
+			ProxyTarget: dr.ProxyTarget,
+			Middleware:  emptyIfNil(dr.MiddlewareNames),
+			Paths:       paths,
+			Listeners:   listeners(dr.Listeners),
+			Conditional: dr.Match != nil,
+			WebSocket:   dr.WebSocket != nil,
+			GRPCWeb:     dr.GRPCWeb,
+		}
+		if dr.Balancer != nil {
+			info.Targets = dr.Balancer.Status()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a stored upstream response. Vary holds the values the request had
+// for the headers listed in the response Vary header, an entry is only used
+// for requests with the same values.
+type Entry struct {
+	Key        string
+	Status     int
+	Header     http.Header
+	Body       []byte
+	Vary       map[string]string
+	StoredAt   time.Time
+	Expires    time.Time
+	StaleUntil time.Time
+}
+
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// Stale reports whether the entry expired but may still be served while it
+// is revalidated
+func (e *Entry) Stale(now time.Time) bool {
+	return !e.Fresh(now) && now.Before(e.StaleUntil)
+}
+
+// Revalidatable reports whether the upstream can be asked if the entry is
+// still valid with a conditional request
+func (e *Entry) Revalidatable() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+func (e *Entry) matches(header http.Header) bool {
+	for name, value := range e.Vary {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body) + len(e.Key))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+// item holds every variant stored for a key
+type item struct {
+	key      string
+	variants []*Entry
+	size     int64
+}
+
+// Store is an in memory LRU cache of entries bounded by the total size of the
+// stored responses. When a disk path is set entries are also written there
+// and read back on memory misses, so they survive restarts and evictions.
+type Store struct {
+	maxSize  int64
+	size     int64
+	diskPath string
+	items    map[string]*list.Element
+	lru      *list.List
+	// purges counts the purges, so that disk reads overlapping one are dropped
+	purges int
+	mu     sync.Mutex
+}
+
+func NewStore(maxSize int64, diskPath string) *Store {
+	if diskPath != "" {
+		if err := os.MkdirAll(diskPath, 0o755); err != nil {
+			log.Fatalf("[CACHE] Failed to create cache directory %s: %v", diskPath, err)
+		}
+	}
+
+	return &Store{
+		maxSize:  maxSize,
+		diskPath: diskPath,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the variant stored for key that matches the request headers
+func (s *Store) Get(key string, header http.Header) (*Entry, bool) {
+	s.mu.Lock()
+	if elem, ok := s.items[key]; ok {
+		defer s.mu.Unlock()
+		return s.match(elem, header)
+	}
+	purges := s.purges
+	s.mu.Unlock()
+
+	// The disk is read without holding the lock, so that a slow read does not
+	// hold up the requests of every other key
+	variants := s.readDisk(key)
+	if len(variants) == 0 {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Variants stored while reading are newer than the disk copy, and a purge
+	// while reading may have removed the file that was read
+	elem, ok := s.items[key]
+	if !ok {
+		if s.purges != purges {
+			return nil, false
+		}
+		elem = s.insert(key, variants)
+	}
+	return s.match(elem, header)
+}
+
+// match returns the variant of elem matching the request headers
+func (s *Store) match(elem *list.Element, header http.Header) (*Entry, bool) {
+	s.lru.MoveToFront(elem)
+	for _, entry := range elem.Value.(*item).variants {
+		if entry.matches(header) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Set stores the entry, replacing the variant with the same Vary values
+func (s *Store) Set(entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var variants []*Entry
+	if elem, ok := s.items[entry.Key]; ok {
+		for _, v := range elem.Value.(*item).variants {
+			if !sameVary(v.Vary, entry.Vary) {
+				variants = append(variants, v)
+			}
+		}
+		s.remove(elem)
+	}
+	variants = append(variants, entry)
+
+	s.insert(entry.Key, variants)
+	s.writeDisk(entry.Key, variants)
+}
+
+// Purge removes the entries whose key starts with prefix and returns how many
+// keys were removed. An empty prefix purges everything.
+func (s *Store) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purges++
+	purged := make(map[string]bool)
+	for key, elem := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(elem)
+			purged[key] = true
+		}
+	}
+
+	if s.diskPath != "" {
+		files, _ := filepath.Glob(filepath.Join(s.diskPath, "*.gob"))
+		for _, file := range files {
+			variants := readEntries(file)
+			if len(variants) != 0 && strings.HasPrefix(variants[0].Key, prefix) {
+				os.Remove(file)
+				purged[variants[0].Key] = true
+			}
+		}
+	}
+
+	return len(purged)
+}
+
+// Len returns the number of keys held in memory
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// Size returns the total size in bytes of the entries held in memory
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+func (s *Store) insert(key string, variants []*Entry) *list.Element {
+	it := &item{key: key, variants: variants}
+	for _, v := range variants {
+		it.size += v.size()
+	}
+
+	elem := s.lru.PushFront(it)
+	s.items[key] = elem
+	s.size += it.size
+
+	// Evict the least recently used keys, the disk copy is kept
+	for s.size > s.maxSize && s.lru.Len() > 1 {
+		s.remove(s.lru.Back())
+	}
+
+	return elem
+}
+
+func (s *Store) remove(elem *list.Element) {
+	it := elem.Value.(*item)
+	s.lru.Remove(elem)
+	delete(s.items, it.key)
+	s.size -= it.size
+}
+
+func sameVary(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if bValue, ok := b[name]; !ok || bValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) diskFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.diskPath, hex.EncodeToString(sum[:])+".gob")
+}
+
+func (s *Store) writeDisk(key string, variants []*Entry) {
+	if s.diskPath == "" {
+		return
+	}
+
+	// Write to a temporary file first so readers never see partial entries
+	tmp, err := os.CreateTemp(s.diskPath, "entry-*")
+	if err != nil {
+		log.Printf("[CACHE] Failed to write entry to disk: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(variants); err != nil {
+		tmp.Close()
+		log.Printf("[CACHE] Failed to write entry to disk: %v", err)
+		return
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmp.Name(), s.diskFile(key)); err != nil {
+		log.Printf("[CACHE] Failed to write entry to disk: %v", err)
+	}
+}
+
+func (s *Store) readDisk(key string) []*Entry {
+	if s.diskPath == "" {
+		return nil
+	}
+
+	variants := readEntries(s.diskFile(key))
+
+	// Drop the variants that can neither be served nor revalidated anymore
+	now := time.Now()
+	valid := variants[:0]
+	for _, v := range variants {
+		if v.Fresh(now) || v.Stale(now) || v.Revalidatable() {
+			valid = append(valid, v)
+		}
+	}
+	return valid
+}
+
+func readEntries(filepath string) []*Entry {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var variants []*Entry
+	if err := gob.NewDecoder(file).Decode(&variants); err != nil {
+		return nil
+	}
+	return variants
+}
+
+var (
+	stores   = make(map[string]*Store)
+	storesMu sync.Mutex
+)
+
+// Named returns the store registered under name, creating it with newStore on
+// first use. Routes referencing the same cache middleware share its store and
+// the purge API finds stores by these names.
+func Named(name string, newStore func() *Store) *Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	s, ok := stores[name]
+	if !ok {
+		s = newStore()
+		stores[name] = s
+	}
+	return s
+}
+
+// Lookup returns the store registered under name
+func Lookup(name string) (*Store, bool) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	s, ok := stores[name]
+	return s, ok
+}
+
+// All returns every registered store by name
+func All() map[string]*Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	all := make(map[string]*Store, len(stores))
+	for name, s := range stores {
+		all[name] = s
+	}
+	return all
+}
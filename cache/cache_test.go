@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestEntry(key string, body string) *Entry {
+	now := time.Now()
+	return &Entry{
+		Key:      key,
+		Status:   http.StatusOK,
+		Header:   http.Header{"Etag": {`"v1"`}},
+		Body:     []byte(body),
+		StoredAt: now,
+		Expires:  now.Add(time.Minute),
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Run("evicts least recently used keys", func(t *testing.T) {
+		s := NewStore(50, "")
+		s.Set(newTestEntry("a", "0123456789"))
+		s.Set(newTestEntry("b", "0123456789"))
+		s.Get("a", nil)
+		s.Set(newTestEntry("c", "0123456789"))
+
+		if _, ok := s.Get("b", nil); ok {
+			t.Error("Expected 'b' to be evicted")
+		}
+		if _, ok := s.Get("a", nil); !ok {
+			t.Error("Expected recently used 'a' to be kept")
+		}
+		if s.Size() > 50 {
+			t.Errorf("Expected size to stay within 50 bytes, got %d", s.Size())
+		}
+	})
+
+	t.Run("keeps variants per key", func(t *testing.T) {
+		s := NewStore(1<<20, "")
+		en := newTestEntry("a", "hello")
+		en.Vary = map[string]string{"Accept-Language": "en"}
+		de := newTestEntry("a", "hallo")
+		de.Vary = map[string]string{"Accept-Language": "de"}
+		s.Set(en)
+		s.Set(de)
+
+		entry, ok := s.Get("a", http.Header{"Accept-Language": {"en"}})
+		if !ok || string(entry.Body) != "hello" {
+			t.Error("Expected the 'en' variant")
+		}
+		if _, ok := s.Get("a", http.Header{"Accept-Language": {"fr"}}); ok {
+			t.Error("Expected no variant for 'fr'")
+		}
+	})
+
+	t.Run("purges by prefix", func(t *testing.T) {
+		s := NewStore(1<<20, "")
+		s.Set(newTestEntry("example.com/api/a", "a"))
+		s.Set(newTestEntry("example.com/api/b", "b"))
+		s.Set(newTestEntry("example.com/static/c", "c"))
+
+		if purged := s.Purge("example.com/api/"); purged != 2 {
+			t.Errorf("Expected 2 purged keys, got %d", purged)
+		}
+		if s.Len() != 1 {
+			t.Errorf("Expected 1 key left, got %d", s.Len())
+		}
+	})
+
+	t.Run("reads entries back from disk", func(t *testing.T) {
+		dir := t.TempDir()
+		NewStore(1<<20, dir).Set(newTestEntry("a", "persisted"))
+
+		entry, ok := NewStore(1<<20, dir).Get("a", nil)
+		if !ok || string(entry.Body) != "persisted" {
+			t.Error("Expected the entry to be read from disk")
+		}
+	})
+
+	t.Run("reads from disk while other keys are used", func(t *testing.T) {
+		dir := t.TempDir()
+		writer := NewStore(1<<20, dir)
+		for i := range 20 {
+			writer.Set(newTestEntry(strconv.Itoa(i), "persisted"))
+		}
+
+		s := NewStore(1<<20, dir)
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if _, ok := s.Get(strconv.Itoa(i), nil); !ok {
+					t.Errorf("Expected '%d' to be read from disk", i)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				s.Set(newTestEntry("memory", "fresh"))
+			}()
+		}
+		wg.Wait()
+
+		if s.Len() != 21 {
+			t.Errorf("Expected 21 keys in memory, got %d", s.Len())
+		}
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name           string
+		policy         Policy
+		header         http.Header
+		expectStored   bool
+		expectLifetime time.Duration
+		expectStale    time.Duration
+	}{
+		{name: "max-age", header: http.Header{"Cache-Control": {"max-age=60"}}, expectStored: true, expectLifetime: time.Minute},
+		{name: "s-maxage wins", header: http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, expectStored: true, expectLifetime: 2 * time.Minute},
+		{name: "ttl override", policy: Policy{TTL: time.Hour}, header: http.Header{"Cache-Control": {"max-age=60"}}, expectStored: true, expectLifetime: time.Hour},
+		{name: "stale-while-revalidate", header: http.Header{"Cache-Control": {"max-age=60, stale-while-revalidate=30"}}, expectStored: true, expectLifetime: time.Minute, expectStale: 30 * time.Second},
+		{name: "must-revalidate disables stale", policy: Policy{StaleWhileRevalidate: time.Minute}, header: http.Header{"Cache-Control": {"max-age=60, must-revalidate"}}, expectStored: true, expectLifetime: time.Minute},
+		{name: "no-cache with validator", header: http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, expectStored: true},
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store, max-age=60"}}},
+		{name: "vary star", header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}},
+		{name: "set-cookie", header: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"session=1"}}},
+		{name: "no freshness nor validators", header: http.Header{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, ok := tc.policy.NewEntry("key", http.StatusOK, tc.header, nil, http.Header{}, now)
+			if ok != tc.expectStored {
+				t.Fatalf("Expected stored: %v, got %v", tc.expectStored, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if lifetime := entry.Expires.Sub(now); lifetime != tc.expectLifetime {
+				t.Errorf("Expected lifetime %v, got %v", tc.expectLifetime, lifetime)
+			}
+			if stale := entry.StaleUntil.Sub(entry.Expires); stale != tc.expectStale {
+				t.Errorf("Expected stale window %v, got %v", tc.expectStale, stale)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status codes that are cacheable by default (RFC 9110 section 15.1)
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusPermanentRedirect:    true,
+}
+
+// ParseCacheControl returns the directives of a Cache-Control header, with the
+// value of directives without an argument set to ""
+func ParseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+func seconds(value string) (time.Duration, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// Policy decides if and for how long responses are stored
+type Policy struct {
+	// TTL overrides the freshness lifetime given by the upstream when set
+	TTL time.Duration
+	// StaleWhileRevalidate overrides the stale-while-revalidate directive when set
+	StaleWhileRevalidate time.Duration
+}
+
+// NewEntry builds the entry for a response, or returns false if the response
+// must not be stored by a shared cache
+func (p Policy) NewEntry(key string, status int, header http.Header, body []byte, reqHeader http.Header, now time.Time) (*Entry, bool) {
+	if !cacheableStatus[status] {
+		return nil, false
+	}
+
+	cc := ParseCacheControl(strings.Join(header.Values("Cache-Control"), ","))
+	if _, ok := cc["no-store"]; ok {
+		return nil, false
+	}
+	if _, ok := cc["private"]; ok {
+		return nil, false
+	}
+	// Cookies are set for a single client and must never be replayed to others
+	if header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+
+	// "Vary: *" means the response depends on more than the request headers
+	vary := make(map[string]string)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				vary[name] = reqHeader.Get(name)
+			}
+		}
+	}
+
+	var lifetime time.Duration
+	var explicit bool
+	if maxAge, ok := seconds(cc["s-maxage"]); ok {
+		lifetime, explicit = maxAge, true
+	} else if maxAge, ok := seconds(cc["max-age"]); ok {
+		lifetime, explicit = maxAge, true
+	} else if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		lifetime, explicit = max(expires.Sub(now), 0), true
+	}
+
+	if p.TTL > 0 {
+		lifetime, explicit = p.TTL, true
+	}
+
+	// Responses that must always be revalidated are stored already expired
+	_, noCache := cc["no-cache"]
+	if noCache {
+		lifetime = 0
+	}
+
+	entry := &Entry{
+		Key:      key,
+		Status:   status,
+		Header:   header.Clone(),
+		Body:     body,
+		Vary:     vary,
+		StoredAt: now,
+		Expires:  now.Add(lifetime),
+	}
+
+	// Without freshness information the entry is only useful to revalidate
+	if !explicit && !noCache && !entry.Revalidatable() {
+		return nil, false
+	}
+
+	staleWhileRevalidate, _ := seconds(cc["stale-while-revalidate"])
+	if p.StaleWhileRevalidate > 0 {
+		staleWhileRevalidate = p.StaleWhileRevalidate
+	}
+	if _, ok := cc["must-revalidate"]; ok || noCache {
+		staleWhileRevalidate = 0
+	}
+	entry.StaleUntil = entry.Expires.Add(staleWhileRevalidate)
+
+	return entry, true
+}
+
+// Refresh updates an entry after the upstream answered a revalidation with
+// 304 Not Modified, taking over the new response headers
+func (p Policy) Refresh(entry *Entry, header http.Header, reqHeader http.Header, now time.Time) (*Entry, bool) {
+	merged := entry.Header.Clone()
+	for name, values := range header {
+		// The stored body is served, not the empty one of the 304
+		if name != "Content-Length" {
+			merged[name] = values
+		}
+	}
+
+	return p.NewEntry(entry.Key, entry.Status, merged, entry.Body, reqHeader, now)
+}
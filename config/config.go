@@ -2,14 +2,22 @@ package config
 
 import (
 	"cloud_gateway/errors"
+	"cloud_gateway/pattern"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"mime"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,33 +34,117 @@ type RateLimitConfig struct {
 	Capacity       int           `json:"capacity" yaml:"capacity"`
 	RefillTokens   int           `json:"refill_tokens" yaml:"refill_tokens"`
 	RefillInterval time.Duration `json:"refill_interval" yaml:"refill_interval"`
+
+	RejectStatus int    `json:"reject_status" yaml:"reject_status"`
+	RejectBody   string `json:"reject_body" yaml:"reject_body"`
+	Mode         string `json:"mode" yaml:"mode"`
+}
+
+type RewriteConfig struct {
+	StripPrefix    string `json:"strip_prefix" yaml:"strip_prefix"`
+	AddPrefix      string `json:"add_prefix" yaml:"add_prefix"`
+	Regex          string `json:"regex" yaml:"regex"`
+	Replacement    string `json:"replacement" yaml:"replacement"`
+	PreservePrefix bool   `json:"preserve_prefix" yaml:"preserve_prefix"`
+}
+
+type WeightedTargetConfig struct {
+	URL    string `json:"url" yaml:"url"`
+	Weight int    `json:"weight" yaml:"weight"`
+}
+
+// StickyConfig keeps a client on the same target, by a cookie issued by the
+// gateway or by hashing an existing cookie, a header or the client ip
+type StickyConfig struct {
+	Cookie     string `json:"cookie" yaml:"cookie"`
+	HashCookie string `json:"hash_cookie" yaml:"hash_cookie"`
+	Header     string `json:"header" yaml:"header"`
+	ClientIP   bool   `json:"client_ip" yaml:"client_ip"`
+}
+
+type HealthCheckConfig struct {
+	Path               string        `json:"path" yaml:"path"`
+	Interval           time.Duration `json:"interval" yaml:"interval"`
+	Timeout            time.Duration `json:"timeout" yaml:"timeout"`
+	UnhealthyThreshold int           `json:"unhealthy_threshold" yaml:"unhealthy_threshold"`
+	HealthyThreshold   int           `json:"healthy_threshold" yaml:"healthy_threshold"`
+}
+
+type MirrorConfig struct {
+	Target      string        `json:"target" yaml:"target"`
+	Percentage  float64       `json:"percentage" yaml:"percentage"`
+	MaxBodySize int64         `json:"max_body_size" yaml:"max_body_size"`
+	Timeout     time.Duration `json:"timeout" yaml:"timeout"`
+}
+
+// WebSocketConfig limits the WebSocket connections proxied by a route, a zero
+// value leaves the limit out
+type WebSocketConfig struct {
+	MaxConnections int           `json:"max_connections" yaml:"max_connections"`
+	IdleTimeout    time.Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxLifetime    time.Duration `json:"max_lifetime" yaml:"max_lifetime"`
+}
+
+type MatchRuleConfig struct {
+	Name   string `json:"name" yaml:"name"`
+	Equals string `json:"equals" yaml:"equals"`
+	Regex  string `json:"regex" yaml:"regex"`
+}
+
+// MatchConfig holds the predicates a request must all satisfy to be served by
+// a route. Rules without 'equals' or 'regex' only require the value to be present.
+type MatchConfig struct {
+	Headers     []*MatchRuleConfig `json:"headers" yaml:"headers"`
+	Query       []*MatchRuleConfig `json:"query" yaml:"query"`
+	Cookies     []*MatchRuleConfig `json:"cookies" yaml:"cookies"`
+	ClientCIDRs []string           `json:"client_cidrs" yaml:"client_cidrs"`
 }
 
 type PathConfig struct {
-	Method          string   `json:"method" yaml:"method"`
-	Path            string   `json:"path" yaml:"path"`
-	Middleware      []string `json:"middleware" yaml:"middleware"`
-	MiddlewareGroup string   `json:"middleware_group" yaml:"middleware_group"`
-	ProxyTarget     string   `json:"proxy_target" yaml:"proxy_target"`
-	RedirectTarget  string   `json:"redirect_target" yaml:"redirect_target"`
-	RedirectCode    int      `json:"redirect_code" yaml:"redirect_code"`
+	Method          string         `json:"method" yaml:"method"`
+	Methods         []string       `json:"methods" yaml:"methods"`
+	Path            string         `json:"path" yaml:"path"`
+	Middleware      []string       `json:"middleware" yaml:"middleware"`
+	MiddlewareGroup string         `json:"middleware_group" yaml:"middleware_group"`
+	ProxyTarget     string         `json:"proxy_target" yaml:"proxy_target"`
+	RedirectTarget  string         `json:"redirect_target" yaml:"redirect_target"`
+	RedirectCode    int            `json:"redirect_code" yaml:"redirect_code"`
+	Rewrite         *RewriteConfig `json:"rewrite" yaml:"rewrite"`
+	Match           *MatchConfig   `json:"match" yaml:"match"`
+	Mirror          *MirrorConfig  `json:"mirror" yaml:"mirror"`
 }
 
 type RouteConfig struct {
-	Prefix          string        `json:"prefix" yaml:"prefix"`
-	Method          string        `json:"method" yaml:"method"`
-	Middleware      []string      `json:"middleware" yaml:"middleware"`
-	MiddlewareGroup string        `json:"middleware_group" yaml:"middleware_group"`
-	ProxyTarget     string        `json:"proxy_target" yaml:"proxy_target"`
-	RedirectTarget  string        `json:"redirect_target" yaml:"redirect_target"`
-	RedirectCode    int           `json:"redirect_code" yaml:"redirect_code"`
-	Paths           []*PathConfig `json:"paths" yaml:"paths"`
+	Prefix          string         `json:"prefix" yaml:"prefix"`
+	Method          string         `json:"method" yaml:"method"`
+	Methods         []string       `json:"methods" yaml:"methods"`
+	Middleware      []string       `json:"middleware" yaml:"middleware"`
+	MiddlewareGroup string         `json:"middleware_group" yaml:"middleware_group"`
+	ProxyTarget     string         `json:"proxy_target" yaml:"proxy_target"`
+	RedirectTarget  string         `json:"redirect_target" yaml:"redirect_target"`
+	RedirectCode    int            `json:"redirect_code" yaml:"redirect_code"`
+	Paths           []*PathConfig  `json:"paths" yaml:"paths"`
+	Rewrite         *RewriteConfig `json:"rewrite" yaml:"rewrite"`
+	Match           *MatchConfig   `json:"match" yaml:"match"`
+	Mirror          *MirrorConfig  `json:"mirror" yaml:"mirror"`
+	// WebSocket applies to the proxy paths of the route too
+	WebSocket *WebSocketConfig `json:"websocket" yaml:"websocket"`
+	// GRPCWeb translates gRPC-Web calls to the route and its paths to gRPC
+	GRPCWeb bool `json:"grpc_web" yaml:"grpc_web"`
+	// Targets replace 'proxy_target' to split traffic between several upstreams
+	Targets     []*WeightedTargetConfig `json:"targets" yaml:"targets"`
+	Sticky      *StickyConfig           `json:"sticky" yaml:"sticky"`
+	HealthCheck *HealthCheckConfig      `json:"health_check" yaml:"health_check"`
+	// Listeners serving the route, the listener of 'HOST' and 'PORT' by default
+	Listeners []string `json:"listeners" yaml:"listeners"`
 }
 
 type DomainPathConfig struct {
-	Path       string   `json:"path" yaml:"path"`
-	Method     string   `json:"method" yaml:"method"`
-	Middleware []string `json:"middleware" yaml:"middleware"`
+	Path       string         `json:"path" yaml:"path"`
+	Method     string         `json:"method" yaml:"method"`
+	Methods    []string       `json:"methods" yaml:"methods"`
+	Middleware []string       `json:"middleware" yaml:"middleware"`
+	Rewrite    *RewriteConfig `json:"rewrite" yaml:"rewrite"`
 }
 
 type DomainRouteConfig struct {
@@ -61,6 +153,15 @@ type DomainRouteConfig struct {
 	Middleware      []string            `json:"middleware" yaml:"middleware"`
 	MiddlewareGroup string              `json:"middleware_group" yaml:"middleware_group"`
 	Paths           []*DomainPathConfig `json:"paths" yaml:"paths"`
+	Rewrite         *RewriteConfig      `json:"rewrite" yaml:"rewrite"`
+	Match           *MatchConfig        `json:"match" yaml:"match"`
+	WebSocket       *WebSocketConfig    `json:"websocket" yaml:"websocket"`
+	GRPCWeb         bool                `json:"grpc_web" yaml:"grpc_web"`
+	// Targets replace 'proxy_target' to split traffic between several upstreams
+	Targets     []*WeightedTargetConfig `json:"targets" yaml:"targets"`
+	Sticky      *StickyConfig           `json:"sticky" yaml:"sticky"`
+	HealthCheck *HealthCheckConfig      `json:"health_check" yaml:"health_check"`
+	Listeners   []string                `json:"listeners" yaml:"listeners"`
 }
 
 type ForwardAuthConfig struct {
@@ -74,9 +175,82 @@ type ForwardAuthConfig struct {
 	AddCookiesToRequest  []string      `json:"add_cookies_to_request" yaml:"add_cookies_to_request"`
 	AddCookiesToResponse []string      `json:"add_cookies_to_response" yaml:"add_cookies_to_response"`
 	CertFilepath         string        `json:"cert_filepath" yaml:"cert_filepath"`
+	Mode                 string        `json:"mode" yaml:"mode"`
+	MaxBodySize          int64         `json:"max_body_size" yaml:"max_body_size"`
+}
+
+type IPFilterConfig struct {
+	Allow          []string      `json:"allow" yaml:"allow"`
+	Deny           []string      `json:"deny" yaml:"deny"`
+	AllowFile      string        `json:"allow_file" yaml:"allow_file"`
+	DenyFile       string        `json:"deny_file" yaml:"deny_file"`
+	ReloadInterval time.Duration `json:"reload_interval" yaml:"reload_interval"`
+	RejectStatus   int           `json:"reject_status" yaml:"reject_status"`
+	RejectBody     string        `json:"reject_body" yaml:"reject_body"`
+}
+
+type GeoIPConfig struct {
+	CountryDatabase string   `json:"country_database" yaml:"country_database"`
+	ASNDatabase     string   `json:"asn_database" yaml:"asn_database"`
+	AllowCountries  []string `json:"allow_countries" yaml:"allow_countries"`
+	DenyCountries   []string `json:"deny_countries" yaml:"deny_countries"`
+	AllowASNs       []uint   `json:"allow_asns" yaml:"allow_asns"`
+	DenyASNs        []uint   `json:"deny_asns" yaml:"deny_asns"`
+	AddHeaders      bool     `json:"add_headers" yaml:"add_headers"`
+	RejectStatus    int      `json:"reject_status" yaml:"reject_status"`
+	RejectBody      string   `json:"reject_body" yaml:"reject_body"`
+}
+
+type CORSConfig struct {
+	AllowOrigins        []string      `json:"allow_origins" yaml:"allow_origins"`
+	AllowOriginPatterns []string      `json:"allow_origin_patterns" yaml:"allow_origin_patterns"`
+	AllowMethods        []string      `json:"allow_methods" yaml:"allow_methods"`
+	AllowHeaders        []string      `json:"allow_headers" yaml:"allow_headers"`
+	ExposeHeaders       []string      `json:"expose_headers" yaml:"expose_headers"`
+	AllowCredentials    bool          `json:"allow_credentials" yaml:"allow_credentials"`
+	MaxAge              time.Duration `json:"max_age" yaml:"max_age"`
+}
+
+type HeaderRulesConfig struct {
+	Set    map[string]string `json:"set" yaml:"set"`
+	Append map[string]string `json:"append" yaml:"append"`
+	Remove []string          `json:"remove" yaml:"remove"`
+	Rename map[string]string `json:"rename" yaml:"rename"`
+}
+
+type HeadersConfig struct {
+	Request  HeaderRulesConfig `json:"request" yaml:"request"`
+	Response HeaderRulesConfig `json:"response" yaml:"response"`
+}
+
+type CacheConfig struct {
+	TTL                  time.Duration `json:"ttl" yaml:"ttl"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate" yaml:"stale_while_revalidate"`
+	MaxSize              int64         `json:"max_size" yaml:"max_size"`
+	MaxEntrySize         int64         `json:"max_entry_size" yaml:"max_entry_size"`
+	DiskPath             string        `json:"disk_path" yaml:"disk_path"`
+}
+
+type CoalescingConfig struct {
+	VaryHeaders []string `json:"vary_headers" yaml:"vary_headers"`
+	MaxBodySize int64    `json:"max_body_size" yaml:"max_body_size"`
+}
+
+type CompressionConfig struct {
+	Encodings    []string `json:"encodings" yaml:"encodings"`
+	MinSize      int      `json:"min_size" yaml:"min_size"`
+	ContentTypes []string `json:"content_types" yaml:"content_types"`
+}
+
+type BodyLimitConfig struct {
+	MaxSize        int64 `json:"max_size" yaml:"max_size"`
+	DecompressGzip bool  `json:"decompress_gzip" yaml:"decompress_gzip"`
 }
 
-type NoCachePolicyConfig struct{}
+type NoCachePolicyConfig struct {
+	Paths        []string `json:"paths" yaml:"paths"`
+	ContentTypes []string `json:"content_types" yaml:"content_types"`
+}
 
 type EnvConfig struct {
 	Host           string   `json:"HOST" yaml:"HOST"`
@@ -85,25 +259,132 @@ type EnvConfig struct {
 	KeyFilepath    string   `json:"KEY_FILEPATH" yaml:"KEY_FILEPATH"`
 	GinMode        string   `json:"GIN_MODE" yaml:"GIN_MODE"`
 	TrustedProxies []string `json:"TRUSTED_PROXIES" yaml:"TRUSTED_PROXIES"`
+	// Metrics are served without authentication on a listener of their own,
+	// which must only be reachable by the metrics collector
+	MetricsPort int    `json:"METRICS_PORT" yaml:"METRICS_PORT"`
+	MetricsPath string `json:"METRICS_PATH" yaml:"METRICS_PATH"`
+	HTTP3Port   int    `json:"HTTP3_PORT" yaml:"HTTP3_PORT"`
+}
+
+// DefaultListener names the listener of 'HOST' and 'PORT', which serves the
+// routes that do not name their listeners
+const DefaultListener = "default"
+
+// ListenerConfig binds an additional address serving the routes naming the
+// listener. With 'redirect_https' it serves no routes and redirects every
+// request to https instead.
+type ListenerConfig struct {
+	Host          string `json:"host" yaml:"host"`
+	Port          int    `json:"port" yaml:"port"`
+	CertFilepath  string `json:"cert_filepath" yaml:"cert_filepath"`
+	KeyFilepath   string `json:"key_filepath" yaml:"key_filepath"`
+	RedirectHTTPS bool   `json:"redirect_https" yaml:"redirect_https"`
+	// HTTPSPort is the port of the redirect location, omitted when it is 443
+	HTTPSPort int `json:"https_port" yaml:"https_port"`
+}
+
+// AdminConfig serves the admin api on a listener of its own. Every request
+// must carry Token as a bearer token.
+type AdminConfig struct {
+	Host         string `json:"host" yaml:"host"`
+	Port         int    `json:"port" yaml:"port"`
+	CertFilepath string `json:"cert_filepath" yaml:"cert_filepath"`
+	KeyFilepath  string `json:"key_filepath" yaml:"key_filepath"`
+	Token        string `json:"token" yaml:"token"`
 }
 
 type Config struct {
 	RateLimiters     map[string]*RateLimitConfig       `json:"rate_limiters" yaml:"rate_limiters"`
 	ForwardAuth      map[string]*ForwardAuthConfig     `json:"forward_auth" yaml:"forward_auth"`
+	IPFilters        map[string]*IPFilterConfig        `json:"ip_filters" yaml:"ip_filters"`
+	GeoIP            map[string]*GeoIPConfig           `json:"geoip" yaml:"geoip"`
+	CORS             map[string]*CORSConfig            `json:"cors" yaml:"cors"`
+	Headers          map[string]*HeadersConfig         `json:"headers" yaml:"headers"`
 	NoCachePolicies  map[string]*NoCachePolicyConfig   `json:"no_cache_policies" yaml:"no_cache_policies"`
+	Caches           map[string]*CacheConfig           `json:"caches" yaml:"caches"`
+	Coalescing       map[string]*CoalescingConfig      `json:"request_coalescing" yaml:"request_coalescing"`
+	Compression      map[string]*CompressionConfig     `json:"compression" yaml:"compression"`
+	BodyLimits       map[string]*BodyLimitConfig       `json:"body_limits" yaml:"body_limits"`
 	MiddlewareGroups map[string]*MiddlewareGroupConfig `json:"middleware_groups" yaml:"middleware_groups"`
+	Listeners        map[string]*ListenerConfig        `json:"listeners" yaml:"listeners"`
+	Admin            *AdminConfig                      `json:"admin" yaml:"admin"`
 	Routes           []*RouteConfig                    `json:"routes" yaml:"routes"`
 	DomainRoutes     []*DomainRouteConfig              `json:"domain_routes" yaml:"domain_routes"`
 	Env              *EnvConfig                        `json:"env" yaml:"env"`
 }
 
+// MethodAny registers a route or path for every http method
+const MethodAny = "ANY"
+
+var allMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodHead,
+	http.MethodOptions, http.MethodDelete, http.MethodConnect, http.MethodTrace,
+}
+
 func isValidMethod(m string) bool {
-	switch m {
-	case "GET", "POST", "PUT", "DELETE", "PATCH":
-		return true
-	default:
-		return false
+	for _, method := range allMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidRouteMethod(m string) bool {
+	return m == MethodAny || isValidMethod(m)
+}
+
+// methodsOf returns the methods defined by either 'method' or 'methods'
+func methodsOf(method string, methods []string) []string {
+	if method != "" {
+		return []string{method}
+	}
+	return methods
+}
+
+// ExpandMethods returns the http methods a route or path is registered for,
+// with 'ANY' standing for all of them
+func ExpandMethods(method string, methods []string) []string {
+	var expanded []string
+	seen := make(map[string]bool)
+	for _, m := range methodsOf(method, methods) {
+		ms := []string{m}
+		if m == MethodAny {
+			ms = allMethods
+		}
+		for _, m := range ms {
+			if !seen[m] {
+				seen[m] = true
+				expanded = append(expanded, m)
+			}
+		}
+	}
+	return expanded
+}
+
+func validateMethods(method string, methods []string, owner string) string {
+	if method != "" && len(methods) != 0 {
+		return fmt.Sprintf("'method' and 'methods' cannot both be defined in %s", owner)
+	}
+
+	for _, m := range methodsOf(method, methods) {
+		if !isValidRouteMethod(m) {
+			return fmt.Sprintf("found invalid http method '%s' in %s", m, owner)
+		}
 	}
+
+	return ""
+}
+
+const (
+	ModeEnforce = "enforce"
+	ModeDryRun  = "dry_run"
+)
+
+// isValidMode reports whether m is a valid middleware mode. In dry run mode
+// violations are only logged and counted while the request is let through.
+func isValidMode(m string) bool {
+	return m == "" || m == ModeEnforce || m == ModeDryRun
 }
 
 func isValidRedirectCode(code int) bool {
@@ -131,6 +412,14 @@ func (cfg *Config) validate() string {
 		}
 	}
 
+	if errString := cfg.validatePatterns(); errString != "" {
+		return errString
+	}
+
+	if errString := cfg.validateRouterPaths(); errString != "" {
+		return errString
+	}
+
 	for _, rateLimiterCfg := range cfg.RateLimiters {
 		if errString := rateLimiterCfg.validate(); errString != "" {
 			return errString
@@ -143,10 +432,134 @@ func (cfg *Config) validate() string {
 		}
 	}
 
+	for _, ipFilterCfg := range cfg.IPFilters {
+		if errString := ipFilterCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, geoIPCfg := range cfg.GeoIP {
+		if errString := geoIPCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, corsCfg := range cfg.CORS {
+		if errString := corsCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, headersCfg := range cfg.Headers {
+		if errString := headersCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, noCachePolicyCfg := range cfg.NoCachePolicies {
+		if errString := noCachePolicyCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, cacheCfg := range cfg.Caches {
+		if errString := cacheCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, coalescingCfg := range cfg.Coalescing {
+		if errString := coalescingCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, compressionCfg := range cfg.Compression {
+		if errString := compressionCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, bodyLimitCfg := range cfg.BodyLimits {
+		if errString := bodyLimitCfg.validate(); errString != "" {
+			return errString
+		}
+	}
+
 	if errString := cfg.Env.validate(); errString != "" {
 		return errString
 	}
 
+	if errString := cfg.validateListeners(); errString != "" {
+		return errString
+	}
+
+	return ""
+}
+
+// validateListeners checks the listeners, the admin api and the listeners
+// named by routes. None of them can share a port, the listeners of 'PORT' and
+// 'METRICS_PORT' included.
+func (cfg *Config) validateListeners() string {
+	ports := map[int]string{cfg.Env.Port: fmt.Sprintf("listener '%s'", DefaultListener)}
+	if cfg.Env.MetricsPort != 0 {
+		ports[cfg.Env.MetricsPort] = "the metrics listener"
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Listeners)) {
+		listenerCfg := cfg.Listeners[name]
+		if name == DefaultListener {
+			return fmt.Sprintf("listener name '%s' is reserved for the listener of 'HOST' and 'PORT'", DefaultListener)
+		}
+
+		if errString := listenerCfg.validate(name); errString != "" {
+			return errString
+		}
+
+		if other, ok := ports[listenerCfg.Port]; ok {
+			return fmt.Sprintf("listener '%s' uses port %d of %s", name, listenerCfg.Port, other)
+		}
+		ports[listenerCfg.Port] = fmt.Sprintf("listener '%s'", name)
+	}
+
+	if cfg.Admin != nil {
+		if errString := cfg.Admin.validate(); errString != "" {
+			return errString
+		}
+
+		if other, ok := ports[cfg.Admin.Port]; ok {
+			return fmt.Sprintf("admin api uses port %d of %s", cfg.Admin.Port, other)
+		}
+	}
+
+	check := func(listeners []string, owner string) string {
+		for _, name := range listeners {
+			if name == DefaultListener {
+				continue
+			}
+
+			listenerCfg, ok := cfg.Listeners[name]
+			if !ok {
+				return fmt.Sprintf("unknown listener '%s' in %s", name, owner)
+			}
+			if listenerCfg.RedirectHTTPS {
+				return fmt.Sprintf("listener '%s' with 'redirect_https' cannot serve %s", name, owner)
+			}
+		}
+		return ""
+	}
+
+	for _, routeCfg := range cfg.Routes {
+		if errString := check(routeCfg.Listeners, fmt.Sprintf("route '%s'", routeCfg.Prefix)); errString != "" {
+			return errString
+		}
+	}
+
+	for _, domainCfg := range cfg.DomainRoutes {
+		if errString := check(domainCfg.Listeners, fmt.Sprintf("domain route '%s'", domainCfg.Domain)); errString != "" {
+			return errString
+		}
+	}
+
 	return ""
 }
 
@@ -159,7 +572,95 @@ func (cfg *RouteConfig) validate() string {
 		return "prefix is missing for base route"
 	}
 
-	if cfg.ProxyTarget != "" {
+	if pattern.IsPattern(cfg.Prefix) {
+		return fmt.Sprintf("prefix '%s' cannot be a path pattern, patterns are only supported in 'path'", cfg.Prefix)
+	}
+
+	if errString := validateTargets(cfg.ProxyTarget, cfg.Targets, cfg.Sticky, cfg.HealthCheck, "base route"); errString != "" {
+		return errString
+	}
+
+	if cfg.Mirror != nil {
+		if cfg.RedirectTarget != "" {
+			return "'mirror' is only supported for proxy routes, not for base route with 'redirect_target'"
+		}
+
+		if errString := cfg.Mirror.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	if cfg.WebSocket != nil {
+		if cfg.RedirectTarget != "" {
+			return "'websocket' is only supported for proxy routes, not for base route with 'redirect_target'"
+		}
+
+		if errString := cfg.WebSocket.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	if cfg.GRPCWeb {
+		if errString := cfg.validateGRPCWeb(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, pathCfg := range cfg.Paths {
+		if pathCfg.Mirror == nil {
+			continue
+		}
+
+		if pathCfg.RedirectTarget != "" {
+			return "'mirror' is only supported for proxy routes, not for path route with 'redirect_target'"
+		}
+
+		if errString := pathCfg.Mirror.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	if cfg.Match != nil {
+		if errString := cfg.Match.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, pathCfg := range cfg.Paths {
+		if pathCfg.Match == nil {
+			continue
+		}
+
+		if errString := pathCfg.Match.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	if cfg.Rewrite != nil {
+		if cfg.RedirectTarget != "" {
+			return "'rewrite' is only supported for proxy routes, not for base route with 'redirect_target'"
+		}
+
+		if errString := cfg.Rewrite.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	for _, pathCfg := range cfg.Paths {
+		if pathCfg.Rewrite == nil {
+			continue
+		}
+
+		if pathCfg.RedirectTarget != "" {
+			return "'rewrite' is only supported for proxy routes, not for path route with 'redirect_target'"
+		}
+
+		if errString := pathCfg.Rewrite.validate(); errString != "" {
+			return errString
+		}
+	}
+
+	if cfg.proxied() {
 		if cfg.RedirectTarget != "" {
 			return "base route with both 'proxy_target' and 'redirect_target' defined is not allowed"
 		}
@@ -196,10 +697,16 @@ func (cfg *RouteConfig) validate() string {
 		if pathCfg.Path == "" {
 			return fmt.Sprintf("path route under prefix '%s' is missing a 'path'", cfg.Prefix)
 		}
+
+		if pattern.IsPattern(pathCfg.Path) {
+			if _, err := pattern.Compile(cfg.patternPath(pathCfg), false); err != nil {
+				return fmt.Sprintf("invalid path pattern '%s' under prefix '%s': %v", pathCfg.Path, cfg.Prefix, err)
+			}
+		}
 	}
 
 	if len(cfg.Paths) != 0 {
-		if cfg.ProxyTarget != "" {
+		if cfg.proxied() {
 			return "base route with defined 'proxy_target' url is not allowed to have paths"
 		}
 
@@ -208,7 +715,7 @@ func (cfg *RouteConfig) validate() string {
 		}
 	}
 
-	if cfg.ProxyTarget == "" && cfg.RedirectTarget == "" {
+	if !cfg.proxied() && cfg.RedirectTarget == "" {
 		if len(cfg.Paths) == 0 {
 			return "'proxy_target' or 'redirect_target' url is missing for route with no paths"
 		}
@@ -238,32 +745,34 @@ func (cfg *RouteConfig) validate() string {
 		}
 	}
 
-	if len(cfg.Paths) == 0 && cfg.Method == "" && cfg.Prefix != "" && cfg.Prefix != "/" {
+	routeMethods := methodsOf(cfg.Method, cfg.Methods)
+	if len(cfg.Paths) == 0 && len(routeMethods) == 0 && cfg.Prefix != "" && cfg.Prefix != "/" {
 		return "http method is missing for a route with no paths"
 	}
 
-	if cfg.Method != "" {
-		if !isValidMethod(cfg.Method) {
-			return fmt.Sprintf("found invalid http method '%s' in a route", cfg.Method)
-		}
+	if errString := validateMethods(cfg.Method, cfg.Methods, "a route"); errString != "" {
+		return errString
+	}
+
+	if len(routeMethods) != 0 {
 		for _, pathCfg := range cfg.Paths {
-			if pathCfg.Method != "" {
+			if len(methodsOf(pathCfg.Method, pathCfg.Methods)) != 0 {
 				return "http method should not be specified both at route and path level"
 			}
 		}
 	}
 
-	if cfg.Method == "" {
+	if len(routeMethods) == 0 {
 		for _, pathCfg := range cfg.Paths {
-			if pathCfg.Method == "" {
+			if len(methodsOf(pathCfg.Method, pathCfg.Methods)) == 0 {
 				return fmt.Sprintf(
 					"path '%s' has no http method and its base route also has no method",
 					pathCfg.Path,
 				)
 			}
 
-			if !isValidMethod(pathCfg.Method) {
-				return fmt.Sprintf("found invalid http method '%s' in a route path", pathCfg.Method)
+			if errString := validateMethods(pathCfg.Method, pathCfg.Methods, "a route path"); errString != "" {
+				return errString
 			}
 		}
 	}
@@ -276,70 +785,889 @@ func (cfg *DomainRouteConfig) validate() string {
 		return "field 'domain' is missing for domain route"
 	}
 
-	if cfg.ProxyTarget == "" {
+	if cfg.ProxyTarget == "" && len(cfg.Targets) == 0 {
 		return "field 'proxy_target' is missing for domain route"
 	}
 
-	return ""
-}
-
-func (cfg *RateLimitConfig) validate() string {
-	if cfg.Ttl <= 0 {
-		return "'ttl' must be a must be a positive duration (e.g., '1h', '30m')"
-	}
-
-	if cfg.CleanupInterval <= 0 {
-		return "'cleanup_interval' must be a positive duration (e.g., '30m', '1h')"
+	if errString := validateTargets(cfg.ProxyTarget, cfg.Targets, cfg.Sticky, cfg.HealthCheck, fmt.Sprintf("domain route '%s'", cfg.Domain)); errString != "" {
+		return errString
 	}
 
-	if cfg.CleanupInterval > cfg.Ttl {
-		return "'cleanup_interval' cannot be longer than 'ttl' (records would expire before cleanup)"
+	if cfg.WebSocket != nil {
+		if errString := cfg.WebSocket.validate(); errString != "" {
+			return errString
+		}
 	}
 
-	switch algo := cfg.Algorithm; algo {
-	case "":
-		return "'algorithm' field is not specified for rate limiter"
-	case "fixed_window_counter":
-		if cfg.Capacity != 0 {
-			return "wrong option 'capacity' is specified for rate limiter 'fixed_window_counter'"
+	for _, pathCfg := range cfg.Paths {
+		if len(methodsOf(pathCfg.Method, pathCfg.Methods)) == 0 {
+			return fmt.Sprintf("path '%s' of domain route '%s' has no http method", pathCfg.Path, cfg.Domain)
 		}
 
-		if cfg.RefillTokens != 0 {
-			return "wrong option 'refill_tokens' is specified for rate limiter 'fixed_window_counter'"
+		if errString := validateMethods(pathCfg.Method, pathCfg.Methods, "a domain route path"); errString != "" {
+			return errString
 		}
 
-		if cfg.RefillInterval != 0 {
-			return "wrong option 'refill_interval' is specified for rate limiter 'fixed_window_counter'"
+		if pattern.IsPattern(pathCfg.Path) {
+			if _, err := pattern.Compile(pathCfg.Path, false); err != nil {
+				return fmt.Sprintf("invalid path pattern '%s' of domain route '%s': %v", pathCfg.Path, cfg.Domain, err)
+			}
 		}
+	}
 
-		if cfg.Limit <= 0 {
-			return "'limit' must be a positive integer"
-		}
-	case "token_bucket":
-		if cfg.Limit != 0 {
-			return "wrong option 'limit' is specified for rate limiter 'token_bucket'"
+	if cfg.Match != nil {
+		if errString := cfg.Match.validate(); errString != "" {
+			return errString
 		}
+	}
 
-		if cfg.WindowSize != 0 {
-			return "wrong option 'window_size' is specified for rate limiter 'token_bucket'"
+	for _, rewrite := range cfg.rewrites() {
+		// Domain routes match no prefix, the whole path is always forwarded
+		if rewrite.PreservePrefix {
+			return fmt.Sprintf("'preserve_prefix' is not supported in the rewrite of domain route '%s'", cfg.Domain)
 		}
 
-		if cfg.Capacity <= 0 {
-			return "'capacity' must be a positive integer"
+		if errString := rewrite.validate(); errString != "" {
+			return errString
 		}
+	}
 
-		if cfg.RefillTokens <= 0 {
-			return "'refill_tokens' must be a positive integer"
+	return ""
+}
+
+// validateGRPCWeb checks that the route proxies gRPC-Web calls, which are
+// always POST requests
+func (cfg *RouteConfig) validateGRPCWeb() string {
+	if cfg.RedirectTarget != "" {
+		return "'grpc_web' is only supported for proxy routes, not for base route with 'redirect_target'"
+	}
+
+	if len(methodsOf(cfg.Method, cfg.Methods)) != 0 {
+		if !slices.Contains(ExpandMethods(cfg.Method, cfg.Methods), http.MethodPost) {
+			return fmt.Sprintf("route '%s' with 'grpc_web' must serve POST requests", cfg.Prefix)
+		}
+		return ""
+	}
+
+	for _, pathCfg := range cfg.Paths {
+		if pathCfg.ProxyTarget != "" && !slices.Contains(ExpandMethods(pathCfg.Method, pathCfg.Methods), http.MethodPost) {
+			return fmt.Sprintf("path '%s' of route '%s' with 'grpc_web' must serve POST requests", pathCfg.Path, cfg.Prefix)
+		}
+	}
+
+	return ""
+}
+
+// proxied reports whether the route proxies to a single or weighted targets
+func (cfg *RouteConfig) proxied() bool {
+	return cfg.ProxyTarget != "" || len(cfg.Targets) != 0
+}
+
+func validateTargets(proxyTarget string, targets []*WeightedTargetConfig, sticky *StickyConfig, healthCheck *HealthCheckConfig, owner string) string {
+	if len(targets) == 0 {
+		if sticky != nil {
+			return fmt.Sprintf("'sticky' defined without 'targets' in %s", owner)
+		}
+		if healthCheck != nil {
+			return fmt.Sprintf("'health_check' defined without 'targets' in %s", owner)
+		}
+		return ""
+	}
+
+	if proxyTarget != "" {
+		return fmt.Sprintf("%s with both 'proxy_target' and 'targets' defined is not allowed", owner)
+	}
+
+	totalWeight := 0
+	for _, target := range targets {
+		if target.URL == "" {
+			return fmt.Sprintf("'url' is missing in a target of %s", owner)
+		}
+		if target.Weight < 0 {
+			return fmt.Sprintf("invalid weight %d of target '%s' in %s. Weight must not be negative", target.Weight, target.URL, owner)
+		}
+		totalWeight += target.Weight
+	}
+	if totalWeight == 0 {
+		return fmt.Sprintf("the weights of the targets of %s must sum up to more than 0", owner)
+	}
+
+	if sticky != nil {
+		modes := 0
+		for _, set := range []bool{sticky.Cookie != "", sticky.HashCookie != "", sticky.Header != "", sticky.ClientIP} {
+			if set {
+				modes++
+			}
+		}
+		if modes != 1 {
+			return fmt.Sprintf("'sticky' in %s needs exactly one of 'cookie', 'hash_cookie', 'header' or 'client_ip'", owner)
+		}
+	}
+
+	if healthCheck != nil {
+		if errString := healthCheck.validate(owner); errString != "" {
+			return errString
+		}
+	}
+
+	return ""
+}
+
+func (cfg *HealthCheckConfig) validate(owner string) string {
+	if cfg.Path != "" && !strings.HasPrefix(cfg.Path, "/") {
+		return fmt.Sprintf("invalid 'path' '%s' of health check in %s. Path must start with '/'", cfg.Path, owner)
+	}
+
+	if cfg.Interval < 0 || cfg.Timeout < 0 {
+		return fmt.Sprintf("'interval' and 'timeout' of health check in %s must be positive", owner)
+	}
+
+	if cfg.UnhealthyThreshold < 0 || cfg.HealthyThreshold < 0 {
+		return fmt.Sprintf("thresholds of health check in %s must be positive", owner)
+	}
+
+	return ""
+}
+
+// patternPath returns the full path of a path route, as matched by its pattern
+func (cfg *RouteConfig) patternPath(pathCfg *PathConfig) string {
+	return strings.TrimSuffix(cfg.Prefix, "/") + pathCfg.Path
+}
+
+// routerPaths returns the paths the registry registers with the router for a
+// route, proxied paths match everything below them
+func (cfg *RouteConfig) routerPaths() []string {
+	if len(cfg.Paths) == 0 {
+		if cfg.RedirectTarget != "" || cfg.Prefix == "" || cfg.Prefix == "/" {
+			return []string{cfg.Prefix}
+		}
+		return []string{cfg.Prefix + "/*path"}
+	}
+
+	var paths []string
+	for _, pathCfg := range cfg.Paths {
+		paths = append(paths, cfg.pathRouterPaths(pathCfg)...)
+	}
+	return paths
+}
+
+// pathRouterPaths returns the paths the registry registers for a path route
+func (cfg *RouteConfig) pathRouterPaths(pathCfg *PathConfig) []string {
+	proxy := pathCfg.ProxyTarget != ""
+	relativePath := cfg.Prefix + pathCfg.Path
+
+	if pattern.IsPattern(pathCfg.Path) {
+		p, err := pattern.Compile(cfg.patternPath(pathCfg), proxy)
+		if err != nil {
+			return nil
+		}
+		switch {
+		case !proxy || p.CatchAll:
+			return []string{p.RouterPath}
+		default:
+			// Proxied patterns also match without a trailing slash
+			return []string{p.RouterPath + "/*path", p.RouterPath}
+		}
+	}
+
+	if proxy {
+		return []string{relativePath + "/*path"}
+	}
+	return []string{relativePath}
+}
+
+// usesCORS reports whether a cors middleware is referenced directly or through
+// the middleware group, such routes answer preflight requests as well
+func (cfg *Config) usesCORS(middlewareGroup string, middleware []string) bool {
+	names := slices.Clone(middleware)
+	if grp, ok := cfg.MiddlewareGroups[middlewareGroup]; ok {
+		names = append(names, *grp...)
+	}
+	return slices.ContainsFunc(names, func(name string) bool {
+		_, ok := cfg.CORS[name]
+		return ok
+	})
+}
+
+// validateRouterPaths rejects routes the router cannot tell apart, like a
+// literal path next to a "**" pattern of the same prefix. The paths are
+// registered the way the registry does with a router of every listener, and
+// of every domain for the patterns of domain routes.
+func (cfg *Config) validateRouterPaths() (errString string) {
+	// Route registrations are only printed for the routers actually serving
+	defer func(printRoute func(string, string, string, int)) {
+		gin.DebugPrintRouteFunc = printRoute
+	}(gin.DebugPrintRouteFunc)
+	gin.DebugPrintRouteFunc = func(string, string, string, int) {}
+
+	routers := make(map[string]*gin.Engine)
+	registered := make(map[string]bool)
+	noop := func(*gin.Context) {}
+
+	register := func(router, method, path, owner string) (errString string) {
+		// Invalid paths are reported by the validation of the route, paths
+		// shared by several routes are told apart by the registry
+		key := router + " " + method + " " + path
+		if !strings.HasPrefix(path, "/") || registered[key] {
+			return ""
+		}
+		registered[key] = true
+
+		r, ok := routers[router]
+		if !ok {
+			r = gin.New()
+			routers[router] = r
+		}
+
+		defer func() {
+			if err := recover(); err != nil {
+				errString = fmt.Sprintf("%s conflicts with another route: %v", owner, err)
+			}
+		}()
+		r.Handle(method, path, noop)
+		return ""
+	}
+
+	for _, routeCfg := range cfg.Routes {
+		listeners := routeCfg.Listeners
+		if len(listeners) == 0 {
+			listeners = []string{DefaultListener}
+		}
+
+		methods := ExpandMethods(routeCfg.Method, routeCfg.Methods)
+		registerRoute := func(owner string, methods []string, paths []string, preflight bool) string {
+			if preflight {
+				methods = append(slices.Clone(methods), http.MethodOptions)
+			}
+			for _, listener := range listeners {
+				for _, method := range methods {
+					for _, path := range paths {
+						if errString := register("listener "+listener, method, path, owner); errString != "" {
+							return errString
+						}
+					}
+				}
+			}
+			return ""
+		}
+
+		routeCORS := cfg.usesCORS(routeCfg.MiddlewareGroup, routeCfg.Middleware)
+		if len(routeCfg.Paths) == 0 {
+			if errString := registerRoute(fmt.Sprintf("route '%s'", routeCfg.Prefix), methods, routeCfg.routerPaths(), routeCORS); errString != "" {
+				return errString
+			}
+			continue
+		}
+
+		for _, pathCfg := range routeCfg.Paths {
+			pathMethods := ExpandMethods(pathCfg.Method, pathCfg.Methods)
+			if len(pathMethods) == 0 {
+				pathMethods = methods
+			}
+			owner := fmt.Sprintf("path '%s' of route '%s'", pathCfg.Path, routeCfg.Prefix)
+			preflight := routeCORS || cfg.usesCORS(pathCfg.MiddlewareGroup, pathCfg.Middleware)
+			if errString := registerRoute(owner, pathMethods, routeCfg.pathRouterPaths(pathCfg), preflight); errString != "" {
+				return errString
+			}
+		}
+	}
+
+	// Literal paths of domain routes are not registered with the router
+	for i, domainCfg := range cfg.DomainRoutes {
+		for _, pathCfg := range domainCfg.Paths {
+			if !pattern.IsPattern(pathCfg.Path) {
+				continue
+			}
+			owner := fmt.Sprintf("path '%s' of domain route '%s'", pathCfg.Path, domainCfg.Domain)
+			p, err := pattern.Compile(pathCfg.Path, false)
+			if err != nil {
+				continue
+			}
+
+			for _, method := range ExpandMethods(pathCfg.Method, pathCfg.Methods) {
+				if errString := register(fmt.Sprintf("domain route %d", i), method, p.RouterPath, owner); errString != "" {
+					return errString
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// validatePatterns rejects path patterns that can never match a request
+// because a pattern defined before them for the same method already matches
+// all of their requests
+func (cfg *Config) validatePatterns() string {
+	// Patterns with match predicates do not serve every request they match
+	check := func(seen map[string][]*pattern.Pattern, key, path string, prefix, conditional bool) string {
+		p, err := pattern.Compile(path, prefix)
+		if err != nil {
+			// Reported by the validation of the route
+			return ""
+		}
+
+		for _, earlier := range seen[key] {
+			if earlier.Shadows(p) {
+				return fmt.Sprintf("path pattern '%s' conflicts with '%s' defined before it", p.Raw, earlier.Raw)
+			}
+		}
+		if !conditional {
+			seen[key] = append(seen[key], p)
+		}
+		return ""
+	}
+
+	// Proxied paths match everything below them too and are registered apart
+	// from redirected ones
+	seen := make(map[string][]*pattern.Pattern)
+	for _, routeCfg := range cfg.Routes {
+		for _, pathCfg := range routeCfg.Paths {
+			if !pattern.IsPattern(pathCfg.Path) {
+				continue
+			}
+
+			methods := ExpandMethods(pathCfg.Method, pathCfg.Methods)
+			if len(methods) == 0 {
+				methods = ExpandMethods(routeCfg.Method, routeCfg.Methods)
+			}
+			proxy := pathCfg.ProxyTarget != ""
+			conditional := routeCfg.Match != nil || pathCfg.Match != nil
+			for _, method := range methods {
+				key := fmt.Sprintf("%s %t", method, proxy)
+				if errString := check(seen, key, routeCfg.patternPath(pathCfg), proxy, conditional); errString != "" {
+					return errString
+				}
+			}
+		}
+	}
+
+	for _, domainCfg := range cfg.DomainRoutes {
+		seen := make(map[string][]*pattern.Pattern)
+		for _, pathCfg := range domainCfg.Paths {
+			if !pattern.IsPattern(pathCfg.Path) {
+				continue
+			}
+
+			for _, method := range ExpandMethods(pathCfg.Method, pathCfg.Methods) {
+				if errString := check(seen, method, pathCfg.Path, false, false); errString != "" {
+					return fmt.Sprintf("%s in domain route '%s'", errString, domainCfg.Domain)
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func (cfg *DomainRouteConfig) rewrites() []*RewriteConfig {
+	var rewrites []*RewriteConfig
+	if cfg.Rewrite != nil {
+		rewrites = append(rewrites, cfg.Rewrite)
+	}
+	for _, pathCfg := range cfg.Paths {
+		if pathCfg.Rewrite != nil {
+			rewrites = append(rewrites, pathCfg.Rewrite)
+		}
+	}
+	return rewrites
+}
+
+func (cfg *MirrorConfig) validate() string {
+	if cfg.Target == "" {
+		return "required field 'target' is missing for mirror"
+	}
+
+	if u, err := url.Parse(cfg.Target); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Sprintf("invalid 'target' '%s' for mirror", cfg.Target)
+	}
+
+	if cfg.Percentage < 0 || cfg.Percentage > 100 {
+		return fmt.Sprintf("invalid 'percentage' %v for mirror. Percentage must be in the range of 0-100", cfg.Percentage)
+	}
+
+	if cfg.MaxBodySize < 0 {
+		return "'max_body_size' of mirror must be a positive size in bytes"
+	}
+
+	if cfg.Timeout < 0 {
+		return "'timeout' of mirror must be positive"
+	}
+
+	return ""
+}
+
+func (cfg *WebSocketConfig) validate() string {
+	if cfg.MaxConnections < 0 {
+		return fmt.Sprintf("invalid 'max_connections' %d for websocket. Max connections must not be negative", cfg.MaxConnections)
+	}
+
+	if cfg.IdleTimeout < 0 || cfg.MaxLifetime < 0 {
+		return "'idle_timeout' and 'max_lifetime' of websocket must be positive"
+	}
+
+	return ""
+}
+
+func (cfg *MatchRuleConfig) validate(kind string) string {
+	if cfg.Name == "" {
+		return fmt.Sprintf("'name' is missing in %s match rule", kind)
+	}
+
+	if cfg.Equals != "" && cfg.Regex != "" {
+		return fmt.Sprintf("%s match rule '%s' cannot define both 'equals' and 'regex'", kind, cfg.Name)
+	}
+
+	if _, err := regexp.Compile(cfg.Regex); err != nil {
+		return fmt.Sprintf("invalid 'regex' '%s' in %s match rule '%s': %v", cfg.Regex, kind, cfg.Name, err)
+	}
+
+	return ""
+}
+
+func (cfg *MatchConfig) validate() string {
+	rules := map[string][]*MatchRuleConfig{"header": cfg.Headers, "query": cfg.Query, "cookie": cfg.Cookies}
+	for _, kind := range []string{"header", "query", "cookie"} {
+		for _, rule := range rules[kind] {
+			if errString := rule.validate(kind); errString != "" {
+				return errString
+			}
+		}
+	}
+
+	for _, cidr := range cfg.ClientCIDRs {
+		if !IsValidIPRange(cidr) {
+			return fmt.Sprintf("invalid ip range '%s' in 'client_cidrs' of match", cidr)
+		}
+	}
+
+	return ""
+}
+
+func (cfg *RewriteConfig) validate() string {
+	if cfg.StripPrefix != "" && !strings.HasPrefix(cfg.StripPrefix, "/") {
+		return fmt.Sprintf("invalid 'strip_prefix' '%s' in rewrite. Prefix must start with '/'", cfg.StripPrefix)
+	}
+
+	if cfg.AddPrefix != "" && !strings.HasPrefix(cfg.AddPrefix, "/") {
+		return fmt.Sprintf("invalid 'add_prefix' '%s' in rewrite. Prefix must start with '/'", cfg.AddPrefix)
+	}
+
+	if cfg.Regex == "" {
+		if cfg.Replacement != "" {
+			return "'replacement' defined without a corresponding 'regex' in rewrite"
+		}
+		return ""
+	}
+
+	if _, err := regexp.Compile(cfg.Regex); err != nil {
+		return fmt.Sprintf("invalid 'regex' '%s' in rewrite: %v", cfg.Regex, err)
+	}
+
+	return ""
+}
+
+func (cfg *RateLimitConfig) validate() string {
+	// The concurrency limiter forgets a key as soon as it has no requests in
+	// flight, so it has no records to expire
+	if cfg.Algorithm != "concurrency" {
+		if cfg.Ttl <= 0 {
+			return "'ttl' must be a must be a positive duration (e.g., '1h', '30m')"
+		}
+
+		if cfg.CleanupInterval <= 0 {
+			return "'cleanup_interval' must be a positive duration (e.g., '30m', '1h')"
+		}
+
+		if cfg.CleanupInterval > cfg.Ttl {
+			return "'cleanup_interval' cannot be longer than 'ttl' (records would expire before cleanup)"
+		}
+	}
+
+	switch algo := cfg.Algorithm; algo {
+	case "":
+		return "'algorithm' field is not specified for rate limiter"
+	case "fixed_window_counter":
+		if cfg.Capacity != 0 {
+			return "wrong option 'capacity' is specified for rate limiter 'fixed_window_counter'"
+		}
+
+		if cfg.RefillTokens != 0 {
+			return "wrong option 'refill_tokens' is specified for rate limiter 'fixed_window_counter'"
+		}
+
+		if cfg.RefillInterval != 0 {
+			return "wrong option 'refill_interval' is specified for rate limiter 'fixed_window_counter'"
+		}
+
+		if cfg.Limit <= 0 {
+			return "'limit' must be a positive integer"
+		}
+
+		if cfg.WindowSize <= 0 {
+			return "'window_size' must be a positive duration (e.g., '1s', '1m')"
+		}
+	case "token_bucket":
+		if cfg.Limit != 0 {
+			return "wrong option 'limit' is specified for rate limiter 'token_bucket'"
+		}
+
+		if cfg.WindowSize != 0 {
+			return "wrong option 'window_size' is specified for rate limiter 'token_bucket'"
+		}
+
+		if cfg.Capacity <= 0 {
+			return "'capacity' must be a positive integer"
+		}
+
+		if cfg.RefillTokens <= 0 {
+			return "'refill_tokens' must be a positive integer"
+		}
+
+		if cfg.RefillInterval <= 0 {
+			return "'refill_interval' must be a positive duration (e.g., '1s', '1m')"
+		}
+	case "sliding_window_log", "sliding_window_counter":
+		if cfg.Capacity != 0 {
+			return fmt.Sprintf("wrong option 'capacity' is specified for rate limiter '%s'", algo)
+		}
+
+		if cfg.RefillTokens != 0 {
+			return fmt.Sprintf("wrong option 'refill_tokens' is specified for rate limiter '%s'", algo)
+		}
+
+		if cfg.RefillInterval != 0 {
+			return fmt.Sprintf("wrong option 'refill_interval' is specified for rate limiter '%s'", algo)
+		}
+
+		if cfg.Limit <= 0 {
+			return "'limit' must be a positive integer"
+		}
+
+		if cfg.WindowSize <= 0 {
+			return "'window_size' must be a positive duration (e.g., '1s', '1m')"
+		}
+	case "concurrency":
+		if cfg.Ttl != 0 {
+			return "wrong option 'ttl' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.CleanupInterval != 0 {
+			return "wrong option 'cleanup_interval' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.WindowSize != 0 {
+			return "wrong option 'window_size' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.Capacity != 0 {
+			return "wrong option 'capacity' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.RefillTokens != 0 {
+			return "wrong option 'refill_tokens' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.RefillInterval != 0 {
+			return "wrong option 'refill_interval' is specified for rate limiter 'concurrency'"
+		}
+
+		if cfg.Limit <= 0 {
+			return "'limit' must be a positive integer"
+		}
+	default:
+		return fmt.Sprintf("unknown rate limit algorithm '%s' specified", algo)
+	}
+
+	if cfg.RejectStatus != 0 && (cfg.RejectStatus < 400 || cfg.RejectStatus > 599) {
+		return fmt.Sprintf("invalid 'reject_status' %d for rate limiter. Must be a 4xx or 5xx status code", cfg.RejectStatus)
+	}
+
+	if !isValidMode(cfg.Mode) {
+		return fmt.Sprintf("invalid 'mode' '%s' for rate limiter. Mode must be either 'enforce' or 'dry_run'", cfg.Mode)
+	}
+	return ""
+}
+
+func (cfg *ForwardAuthConfig) validate() string {
+	if cfg.Url == "" {
+		return "required field 'url' is missing for forward auth middleware"
+	}
+
+	if !isValidMode(cfg.Mode) {
+		return fmt.Sprintf("invalid 'mode' '%s' for forward auth middleware. Mode must be either 'enforce' or 'dry_run'", cfg.Mode)
+	}
+
+	if cfg.MaxBodySize < 0 {
+		return "'max_body_size' of forward auth middleware must be a positive size in bytes"
+	}
+
+	return ""
+}
+
+// IsValidIPRange reports whether s is a CIDR range or a single IP address
+func IsValidIPRange(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+func (cfg *IPFilterConfig) validate() string {
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 && cfg.AllowFile == "" && cfg.DenyFile == "" {
+		return "ip filter middleware must define at least one of 'allow', 'deny', 'allow_file' or 'deny_file'"
+	}
+
+	for _, r := range append(append([]string{}, cfg.Allow...), cfg.Deny...) {
+		if !IsValidIPRange(r) {
+			return fmt.Sprintf("invalid ip range '%s' in ip filter middleware", r)
+		}
+	}
+
+	if cfg.ReloadInterval < 0 {
+		return "'reload_interval' must be a positive duration (e.g., '30s', '5m')"
+	}
+
+	if cfg.RejectStatus != 0 && (cfg.RejectStatus < 400 || cfg.RejectStatus > 599) {
+		return fmt.Sprintf("invalid 'reject_status' %d for ip filter. Must be a 4xx or 5xx status code", cfg.RejectStatus)
+	}
+
+	return ""
+}
+
+func (cfg *GeoIPConfig) validate() string {
+	if cfg.CountryDatabase == "" && cfg.ASNDatabase == "" {
+		return "geoip middleware must define at least one of 'country_database' or 'asn_database'"
+	}
+
+	if cfg.CountryDatabase == "" && (len(cfg.AllowCountries) != 0 || len(cfg.DenyCountries) != 0) {
+		return "geoip middleware with country rules requires a 'country_database'"
+	}
+
+	if cfg.ASNDatabase == "" && (len(cfg.AllowASNs) != 0 || len(cfg.DenyASNs) != 0) {
+		return "geoip middleware with asn rules requires an 'asn_database'"
+	}
+
+	for _, country := range append(append([]string{}, cfg.AllowCountries...), cfg.DenyCountries...) {
+		if len(country) != 2 || strings.ToUpper(country) != country {
+			return fmt.Sprintf("invalid country code '%s' in geoip middleware. Must be an uppercase ISO 3166-1 alpha-2 code", country)
+		}
+	}
+
+	if cfg.RejectStatus != 0 && (cfg.RejectStatus < 400 || cfg.RejectStatus > 599) {
+		return fmt.Sprintf("invalid 'reject_status' %d for geoip. Must be a 4xx or 5xx status code", cfg.RejectStatus)
+	}
+
+	return ""
+}
+
+func (cfg *CORSConfig) validate() string {
+	if len(cfg.AllowOrigins) == 0 && len(cfg.AllowOriginPatterns) == 0 {
+		return "cors middleware must define at least one of 'allow_origins' or 'allow_origin_patterns'"
+	}
+
+	for _, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return "cors middleware with 'allow_credentials' cannot allow any origin '*'"
+			}
+			continue
+		}
+
+		if strings.Count(origin, "*") > 1 || (strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			return fmt.Sprintf("invalid origin '%s' in cors middleware. Wildcards are only allowed as a subdomain, e.g. 'https://*.example.com'", origin)
+		}
+	}
+
+	for _, pattern := range cfg.AllowOriginPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Sprintf("invalid origin pattern '%s' in cors middleware: %v", pattern, err)
+		}
+	}
+
+	for _, method := range cfg.AllowMethods {
+		if !isValidMethod(method) {
+			return fmt.Sprintf("found invalid http method '%s' in cors middleware", method)
 		}
+	}
+
+	if cfg.MaxAge < 0 {
+		return "'max_age' must be a positive duration (e.g., '10m', '1h')"
+	}
+
+	return ""
+}
+
+// TemplateVariable matches the variables that can be referenced in header
+// value templates, e.g. "{client_ip}" or "{param.id}"
+var TemplateVariable = regexp.MustCompile(`\{([a-z_]+(?:\.[A-Za-z0-9_]+)?)\}`)
+
+func isValidTemplateVariable(v string) bool {
+	switch v {
+	case "client_ip", "host", "method", "path", "request_id":
+		return true
 	default:
-		return fmt.Sprintf("unknown rate limit algorithm '%s' specified", algo)
+		return strings.HasPrefix(v, "param.")
+	}
+}
+
+func (cfg *HeaderRulesConfig) validate(direction string) string {
+	for _, values := range []map[string]string{cfg.Set, cfg.Append} {
+		for header, value := range values {
+			for _, match := range TemplateVariable.FindAllStringSubmatch(value, -1) {
+				if !isValidTemplateVariable(match[1]) {
+					return fmt.Sprintf("unknown template variable '%s' in %s header '%s'", match[0], direction, header)
+				}
+			}
+		}
+	}
+
+	for from, to := range cfg.Rename {
+		if to == "" {
+			return fmt.Sprintf("%s header '%s' is renamed to an empty name", direction, from)
+		}
 	}
+
 	return ""
 }
 
-func (cfg *ForwardAuthConfig) validate() string {
-	if cfg.Url == "" {
-		return "required field 'url' is missing for forward auth middleware"
+func (cfg *HeadersConfig) validate() string {
+	if errString := cfg.Request.validate("request"); errString != "" {
+		return errString
+	}
+
+	return cfg.Response.validate("response")
+}
+
+func (cfg *NoCachePolicyConfig) validate() string {
+	for _, p := range cfg.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Sprintf("invalid path '%s' in no cache policy. Path must start with '/'", p)
+		}
+	}
+
+	for _, contentType := range cfg.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Sprintf("invalid content type '%s' in no cache policy", contentType)
+		}
+	}
+
+	return ""
+}
+
+func (cfg *CacheConfig) validate() string {
+	if cfg.TTL < 0 {
+		return "'ttl' must be a positive duration (e.g., '30s', '5m')"
+	}
+
+	if cfg.StaleWhileRevalidate < 0 {
+		return "'stale_while_revalidate' must be a positive duration (e.g., '30s', '5m')"
+	}
+
+	if cfg.MaxSize < 0 || cfg.MaxEntrySize < 0 {
+		return "'max_size' and 'max_entry_size' of cache must be positive sizes in bytes"
+	}
+
+	if cfg.MaxEntrySize > cfg.MaxSize && cfg.MaxSize != 0 {
+		return "'max_entry_size' of cache cannot be larger than 'max_size'"
+	}
+
+	return ""
+}
+
+func (cfg *CoalescingConfig) validate() string {
+	for _, name := range cfg.VaryHeaders {
+		if strings.TrimSpace(name) == "" {
+			return "empty header name in 'vary_headers' of request coalescing"
+		}
+	}
+
+	if cfg.MaxBodySize < 0 {
+		return "'max_body_size' of request coalescing must be a positive size in bytes"
+	}
+
+	return ""
+}
+
+func isValidEncoding(e string) bool {
+	switch e {
+	case "gzip", "br", "zstd":
+		return true
+	default:
+		return false
+	}
+}
+
+func (cfg *CompressionConfig) validate() string {
+	for _, encoding := range cfg.Encodings {
+		if !isValidEncoding(encoding) {
+			return fmt.Sprintf("unsupported encoding '%s' in compression middleware. Supported encodings are 'gzip', 'br' and 'zstd'", encoding)
+		}
+	}
+
+	if cfg.MinSize < 0 {
+		return "'min_size' of compression middleware must be a positive size in bytes"
+	}
+
+	for _, contentType := range cfg.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Sprintf("invalid content type '%s' in compression middleware", contentType)
+		}
+	}
+
+	return ""
+}
+
+func (cfg *BodyLimitConfig) validate() string {
+	if cfg.MaxSize < 0 {
+		return "'max_size' of body limit must be a positive size in bytes"
+	}
+
+	// Decompressed bodies are only bounded by the limit
+	if cfg.MaxSize == 0 && cfg.DecompressGzip {
+		return "'decompress_gzip' of body limit requires 'max_size', the limit applies to the decompressed body"
+	}
+
+	if cfg.MaxSize == 0 {
+		return "body limit must define 'max_size'"
+	}
+
+	return ""
+}
+
+func (cfg *ListenerConfig) validate(name string) string {
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Sprintf("invalid 'port' %d of listener '%s'. Port number must be in the range of 1-65535", cfg.Port, name)
+	}
+
+	if (cfg.CertFilepath == "") != (cfg.KeyFilepath == "") {
+		return fmt.Sprintf("listener '%s' must define both 'cert_filepath' and 'key_filepath' or neither", name)
+	}
+
+	if cfg.RedirectHTTPS && cfg.CertFilepath != "" {
+		return fmt.Sprintf("listener '%s' with 'redirect_https' cannot serve TLS", name)
+	}
+
+	if cfg.HTTPSPort < 0 || cfg.HTTPSPort > 65535 {
+		return fmt.Sprintf("invalid 'https_port' %d of listener '%s'. Port number must be in the range of 0-65535", cfg.HTTPSPort, name)
+	}
+
+	return ""
+}
+
+func (cfg *AdminConfig) validate() string {
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Sprintf("invalid 'port' %d of admin api. Port number must be in the range of 1-65535", cfg.Port)
+	}
+
+	if (cfg.CertFilepath == "") != (cfg.KeyFilepath == "") {
+		return "admin api must define both 'cert_filepath' and 'key_filepath' or neither"
+	}
+
+	if cfg.Token == "" {
+		return "'token' is missing for admin api"
 	}
 
 	return ""
@@ -350,22 +1678,89 @@ func (cfg *EnvConfig) validate() string {
 		return "invalid 'PORT'. Port number must be in the range of 0-65535"
 	}
 
+	if cfg.HTTP3Port < 0 || cfg.HTTP3Port > 65535 {
+		return "invalid 'HTTP3_PORT'. Port number must be in the range of 0-65535"
+	}
+
+	// QUIC always runs over TLS, with the certificate of the TLS listener
+	if cfg.HTTP3Port != 0 && (cfg.CertFilepath == "" || cfg.KeyFilepath == "") {
+		return "'HTTP3_PORT' requires 'CERT_FILEPATH' and 'KEY_FILEPATH' to be defined"
+	}
+
 	if cfg.GinMode != "" && cfg.GinMode != "release" && cfg.GinMode != "debug" {
 		return "invalid 'GIN_MODE'. Gin mode must be either 'release' or 'debug'"
 	}
 
+	if cfg.MetricsPort < 0 || cfg.MetricsPort > 65535 {
+		return "invalid 'METRICS_PORT'. Port number must be in the range of 0-65535"
+	}
+
+	if cfg.MetricsPort != 0 && cfg.MetricsPort == cfg.Port {
+		return "'METRICS_PORT' cannot be the same as 'PORT', metrics are served on a listener of their own"
+	}
+
+	if cfg.MetricsPath != "" && cfg.MetricsPort == 0 {
+		return "'METRICS_PATH' requires 'METRICS_PORT', metrics are served on a listener of their own"
+	}
+
+	if cfg.MetricsPath != "" && !strings.HasPrefix(cfg.MetricsPath, "/") {
+		return "invalid 'METRICS_PATH'. Path must start with '/'"
+	}
+
 	return ""
 }
 
 func (cfg *Config) setDefaults() {
+	for _, rateLimiterCfg := range cfg.RateLimiters {
+		rateLimiterCfg.setDefaults()
+	}
+
 	for _, forwardAuthCfg := range cfg.ForwardAuth {
 		forwardAuthCfg.setDefaults()
 	}
 
+	for _, ipFilterCfg := range cfg.IPFilters {
+		ipFilterCfg.setDefaults()
+	}
+
+	for _, geoIPCfg := range cfg.GeoIP {
+		geoIPCfg.setDefaults()
+	}
+
+	for _, corsCfg := range cfg.CORS {
+		corsCfg.setDefaults()
+	}
+
+	for _, cacheCfg := range cfg.Caches {
+		cacheCfg.setDefaults()
+	}
+
+	for _, coalescingCfg := range cfg.Coalescing {
+		coalescingCfg.setDefaults()
+	}
+
+	for _, compressionCfg := range cfg.Compression {
+		compressionCfg.setDefaults()
+	}
+
 	for _, routeCfg := range cfg.Routes {
 		routeCfg.setDefaults()
 	}
 
+	for _, domainCfg := range cfg.DomainRoutes {
+		if domainCfg.HealthCheck != nil {
+			domainCfg.HealthCheck.setDefaults()
+		}
+	}
+
+	for _, listenerCfg := range cfg.Listeners {
+		listenerCfg.setDefaults()
+	}
+
+	if cfg.Admin != nil {
+		cfg.Admin.setDefaults()
+	}
+
 	if cfg.Env == nil {
 		cfg.Env = &EnvConfig{
 			Host:           "",
@@ -379,6 +1774,20 @@ func (cfg *Config) setDefaults() {
 	cfg.Env.setDefaults()
 }
 
+func (cfg *RateLimitConfig) setDefaults() {
+	if cfg.RejectStatus == 0 {
+		cfg.RejectStatus = http.StatusTooManyRequests
+	}
+
+	if cfg.RejectBody == "" {
+		cfg.RejectBody = `{"error":"rate limit exceeded"}`
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeEnforce
+	}
+}
+
 func (cfg *ForwardAuthConfig) setDefaults() {
 	if cfg.Method == "" {
 		cfg.Method = "GET"
@@ -387,21 +1796,166 @@ func (cfg *ForwardAuthConfig) setDefaults() {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 5 * time.Second
 	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeEnforce
+	}
+
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+}
+
+func (cfg *IPFilterConfig) setDefaults() {
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = 30 * time.Second
+	}
+
+	if cfg.RejectStatus == 0 {
+		cfg.RejectStatus = http.StatusForbidden
+	}
+
+	if cfg.RejectBody == "" {
+		cfg.RejectBody = `{"error":"access denied"}`
+	}
+}
+
+func (cfg *GeoIPConfig) setDefaults() {
+	if cfg.RejectStatus == 0 {
+		cfg.RejectStatus = http.StatusForbidden
+	}
+
+	if cfg.RejectBody == "" {
+		cfg.RejectBody = `{"error":"access denied"}`
+	}
+}
+
+func (cfg *CORSConfig) setDefaults() {
+	if len(cfg.AllowMethods) == 0 {
+		cfg.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH"}
+	}
+}
+
+func (cfg *CacheConfig) setDefaults() {
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = 64 << 20
+	}
+
+	if cfg.MaxEntrySize == 0 {
+		cfg.MaxEntrySize = min(1<<20, cfg.MaxSize)
+	}
+}
+
+func (cfg *CoalescingConfig) setDefaults() {
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+}
+
+func (cfg *CompressionConfig) setDefaults() {
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{"zstd", "br", "gzip"}
+	}
+
+	if cfg.MinSize == 0 {
+		cfg.MinSize = 1024
+	}
+
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = []string{
+			"text/*",
+			"application/json",
+			"application/*+json",
+			"application/javascript",
+			"application/xml",
+			"application/*+xml",
+			"image/svg+xml",
+		}
+	}
 }
 
 func (cfg *RouteConfig) setDefaults() {
+	if cfg.Mirror != nil {
+		cfg.Mirror.setDefaults()
+	}
+
+	if cfg.HealthCheck != nil {
+		cfg.HealthCheck.setDefaults()
+	}
+
 	for _, pathCfg := range cfg.Paths {
-		if pathCfg.Method == "" {
+		if pathCfg.Method == "" && len(pathCfg.Methods) == 0 {
 			pathCfg.Method = cfg.Method
+			pathCfg.Methods = cfg.Methods
+		}
+
+		if pathCfg.Mirror != nil {
+			pathCfg.Mirror.setDefaults()
 		}
 	}
 }
 
+func (cfg *HealthCheckConfig) setDefaults() {
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+
+	if cfg.UnhealthyThreshold == 0 {
+		cfg.UnhealthyThreshold = 3
+	}
+
+	if cfg.HealthyThreshold == 0 {
+		cfg.HealthyThreshold = 2
+	}
+}
+
+func (cfg *MirrorConfig) setDefaults() {
+	if cfg.Percentage == 0 {
+		cfg.Percentage = 100
+	}
+
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+}
+
+func (cfg *AdminConfig) setDefaults() {
+	if cfg.Host == "" {
+		cfg.Host = "0.0.0.0"
+	}
+}
+
+func (cfg *ListenerConfig) setDefaults() {
+	if cfg.Host == "" {
+		cfg.Host = "0.0.0.0"
+	}
+
+	if cfg.RedirectHTTPS && cfg.HTTPSPort == 0 {
+		cfg.HTTPSPort = 443
+	}
+}
+
 func (cfg *EnvConfig) setDefaults() {
 	if cfg.Port == 0 {
 		cfg.Port = 8080
 	}
 
+	if cfg.MetricsPort != 0 && cfg.MetricsPath == "" {
+		cfg.MetricsPath = "/metrics"
+	}
+
 	if cfg.Host == "" {
 		cfg.Host = "0.0.0.0"
 	}
@@ -139,6 +139,55 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErr: "path '/bar' has no http method and its base route also has no method",
 		},
+		{
+			name: "route with methods list",
+			cfg: &RouteConfig{
+				Prefix:      "/foo",
+				ProxyTarget: "https://proxy.com",
+				Methods:     []string{"GET", "HEAD", "OPTIONS"},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "route with both method and methods",
+			cfg: &RouteConfig{
+				Prefix:      "/foo",
+				ProxyTarget: "https://proxy.com",
+				Method:      "GET",
+				Methods:     []string{"POST"},
+			},
+			expectedErr: "'method' and 'methods' cannot both be defined in a route",
+		},
+		{
+			name: "invalid method in methods of path",
+			cfg: &RouteConfig{
+				Prefix: "/foo",
+				Paths: []*PathConfig{
+					{Path: "/bar", Methods: []string{"ANY", "FETCH"}, ProxyTarget: "https://x.com"},
+				},
+			},
+			expectedErr: "found invalid http method 'FETCH' in a route path",
+		},
+		{
+			name: "methods at route and path level",
+			cfg: &RouteConfig{
+				Prefix:  "/foo",
+				Methods: []string{"GET"},
+				Paths: []*PathConfig{
+					{Path: "/bar", Method: "ANY", ProxyTarget: "https://x.com"},
+				},
+			},
+			expectedErr: "http method should not be specified both at route and path level",
+		},
+		{
+			name: "domain route path without method",
+			cfg: &DomainRouteConfig{
+				Domain:      "example.com",
+				ProxyTarget: "https://proxy.com",
+				Paths:       []*DomainPathConfig{{Path: "/status"}},
+			},
+			expectedErr: "path '/status' of domain route 'example.com' has no http method",
+		},
 		{
 			name: "domain route missing domain field",
 			cfg: &DomainRouteConfig{
@@ -261,11 +310,612 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErr: "'refill_tokens' must be a positive integer",
 		},
+		{
+			name: "sliding window log algorithm has invalid 'capacity' field",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "sliding_window_log",
+				Limit:           10,
+				WindowSize:      5 * time.Second,
+				Capacity:        2,
+			},
+			expectedErr: "wrong option 'capacity' is specified for rate limiter 'sliding_window_log'",
+		},
+		{
+			name: "sliding window counter algorithm has invalid 'refill_interval' field",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "sliding_window_counter",
+				Limit:           10,
+				WindowSize:      5 * time.Second,
+				RefillInterval:  5 * time.Second,
+			},
+			expectedErr: "wrong option 'refill_interval' is specified for rate limiter 'sliding_window_counter'",
+		},
+		{
+			name: "sliding window counter algorithm has missing window size",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "sliding_window_counter",
+				Limit:           10,
+			},
+			expectedErr: "'window_size' must be a positive duration (e.g., '1s', '1m')",
+		},
+		{
+			name: "sliding window log algorithm has negative limit",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "sliding_window_log",
+				Limit:           -1,
+				WindowSize:      5 * time.Second,
+			},
+			expectedErr: "'limit' must be a positive integer",
+		},
+		{
+			name: "concurrency algorithm has invalid 'window_size' field",
+			cfg: &RateLimitConfig{
+				Algorithm:  "concurrency",
+				Limit:      10,
+				WindowSize: 5 * time.Second,
+			},
+			expectedErr: "wrong option 'window_size' is specified for rate limiter 'concurrency'",
+		},
+		{
+			name: "concurrency algorithm has invalid 'ttl' field",
+			cfg: &RateLimitConfig{
+				Algorithm: "concurrency",
+				Limit:     10,
+				Ttl:       time.Hour,
+			},
+			expectedErr: "wrong option 'ttl' is specified for rate limiter 'concurrency'",
+		},
+		{
+			name: "concurrency algorithm has missing limit",
+			cfg: &RateLimitConfig{
+				Algorithm: "concurrency",
+			},
+			expectedErr: "'limit' must be a positive integer",
+		},
+		{
+			name: "valid concurrency rate limiter",
+			cfg: &RateLimitConfig{
+				Algorithm: "concurrency",
+				Limit:     5,
+			},
+			expectedErr: "",
+		},
+		{
+			name: "fixed window counter algorithm has missing window size",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "fixed_window_counter",
+				Limit:           10,
+			},
+			expectedErr: "'window_size' must be a positive duration (e.g., '1s', '1m')",
+		},
+		{
+			name: "token bucket algorithm has missing refill interval",
+			cfg: &RateLimitConfig{
+				Ttl:             time.Hour,
+				CleanupInterval: time.Hour,
+				Algorithm:       "token_bucket",
+				Capacity:        10,
+				RefillTokens:    10,
+			},
+			expectedErr: "'refill_interval' must be a positive duration (e.g., '1s', '1m')",
+		},
+		{
+			name: "rate limiter has a non error 'reject_status'",
+			cfg: &RateLimitConfig{
+				Algorithm:    "concurrency",
+				Limit:        5,
+				RejectStatus: 200,
+			},
+			expectedErr: "invalid 'reject_status' 200 for rate limiter. Must be a 4xx or 5xx status code",
+		},
 		{
 			name:        "forward auth missing 'url' field",
 			cfg:         &ForwardAuthConfig{},
 			expectedErr: "required field 'url' is missing for forward auth middleware",
 		},
+		{
+			name: "rate limiter has an invalid 'mode'",
+			cfg: &RateLimitConfig{
+				Algorithm: "concurrency",
+				Limit:     5,
+				Mode:      "shadow",
+			},
+			expectedErr: "invalid 'mode' 'shadow' for rate limiter. Mode must be either 'enforce' or 'dry_run'",
+		},
+		{
+			name: "forward auth has an invalid 'mode'",
+			cfg: &ForwardAuthConfig{
+				Url:  "https://auth.com",
+				Mode: "shadow",
+			},
+			expectedErr: "invalid 'mode' 'shadow' for forward auth middleware. Mode must be either 'enforce' or 'dry_run'",
+		},
+		{
+			name:        "ip filter without any list",
+			cfg:         &IPFilterConfig{},
+			expectedErr: "ip filter middleware must define at least one of 'allow', 'deny', 'allow_file' or 'deny_file'",
+		},
+		{
+			name: "ip filter with invalid range",
+			cfg: &IPFilterConfig{
+				Allow: []string{"10.0.0.0/8"},
+				Deny:  []string{"10.0.0.0/33"},
+			},
+			expectedErr: "invalid ip range '10.0.0.0/33' in ip filter middleware",
+		},
+		{
+			name: "geoip country rules without country database",
+			cfg: &GeoIPConfig{
+				ASNDatabase:   "/data/asn.mmdb",
+				DenyCountries: []string{"CN"},
+			},
+			expectedErr: "geoip middleware with country rules requires a 'country_database'",
+		},
+		{
+			name: "geoip invalid country code",
+			cfg: &GeoIPConfig{
+				CountryDatabase: "/data/country.mmdb",
+				AllowCountries:  []string{"gb"},
+			},
+			expectedErr: "invalid country code 'gb' in geoip middleware. Must be an uppercase ISO 3166-1 alpha-2 code",
+		},
+		{
+			name: "cors any origin with credentials",
+			cfg: &CORSConfig{
+				AllowOrigins:     []string{"*"},
+				AllowCredentials: true,
+			},
+			expectedErr: "cors middleware with 'allow_credentials' cannot allow any origin '*'",
+		},
+		{
+			name: "cors wildcard outside of subdomain",
+			cfg: &CORSConfig{
+				AllowOrigins: []string{"https://example.*"},
+			},
+			expectedErr: "invalid origin 'https://example.*' in cors middleware. Wildcards are only allowed as a subdomain, e.g. 'https://*.example.com'",
+		},
+		{
+			name: "headers with unknown template variable",
+			cfg: &HeadersConfig{
+				Request: HeaderRulesConfig{
+					Set: map[string]string{"X-Client": "{client_port}"},
+				},
+			},
+			expectedErr: "unknown template variable '{client_port}' in request header 'X-Client'",
+		},
+		{
+			name: "no cache policy with relative path",
+			cfg: &NoCachePolicyConfig{
+				Paths: []string{"app"},
+			},
+			expectedErr: "invalid path 'app' in no cache policy. Path must start with '/'",
+		},
+		{
+			name: "cache with negative ttl",
+			cfg: &CacheConfig{
+				TTL: -time.Second,
+			},
+			expectedErr: "'ttl' must be a positive duration (e.g., '30s', '5m')",
+		},
+		{
+			name: "cache entry larger than cache",
+			cfg: &CacheConfig{
+				MaxSize:      1024,
+				MaxEntrySize: 2048,
+			},
+			expectedErr: "'max_entry_size' of cache cannot be larger than 'max_size'",
+		},
+		{
+			name: "request coalescing with empty vary header",
+			cfg: &CoalescingConfig{
+				VaryHeaders: []string{"Accept", " "},
+			},
+			expectedErr: "empty header name in 'vary_headers' of request coalescing",
+		},
+		{
+			name: "compression with unsupported encoding",
+			cfg: &CompressionConfig{
+				Encodings: []string{"gzip", "deflate"},
+			},
+			expectedErr: "unsupported encoding 'deflate' in compression middleware. Supported encodings are 'gzip', 'br' and 'zstd'",
+		},
+		{
+			name:        "body limit without effect",
+			cfg:         &BodyLimitConfig{},
+			expectedErr: "body limit must define 'max_size'",
+		},
+		{
+			name:        "body limit decompressing without limit",
+			cfg:         &BodyLimitConfig{DecompressGzip: true},
+			expectedErr: "'decompress_gzip' of body limit requires 'max_size', the limit applies to the decompressed body",
+		},
+		{
+			name: "rewrite on redirect route",
+			cfg: &RouteConfig{
+				Prefix:         "/foo",
+				Method:         "GET",
+				RedirectTarget: "https://redirect.com",
+				RedirectCode:   307,
+				Rewrite:        &RewriteConfig{StripPrefix: "/v1"},
+			},
+			expectedErr: "'rewrite' is only supported for proxy routes, not for base route with 'redirect_target'",
+		},
+		{
+			name: "rewrite with invalid regex",
+			cfg: &RouteConfig{
+				Prefix:      "/foo",
+				Method:      "GET",
+				ProxyTarget: "https://proxy.com",
+				Rewrite:     &RewriteConfig{Regex: "^/(v[0-9]+", Replacement: "/$1"},
+			},
+			expectedErr: "invalid 'regex' '^/(v[0-9]+' in rewrite: error parsing regexp: missing closing ): `^/(v[0-9]+`",
+		},
+		{
+			name: "rewrite replacement without regex",
+			cfg: &RewriteConfig{
+				Replacement: "/api",
+			},
+			expectedErr: "'replacement' defined without a corresponding 'regex' in rewrite",
+		},
+		{
+			name: "domain route rewrite preserving prefix",
+			cfg: &DomainRouteConfig{
+				Domain:      "example.com",
+				ProxyTarget: "http://localhost:8080",
+				Rewrite:     &RewriteConfig{PreservePrefix: true},
+			},
+			expectedErr: "'preserve_prefix' is not supported in the rewrite of domain route 'example.com'",
+		},
+		{
+			name: "invalid path pattern",
+			cfg: &RouteConfig{
+				Prefix: "/api",
+				Paths:  []*PathConfig{{Path: "/users/{id", Method: "GET", ProxyTarget: "http://localhost:8080"}},
+			},
+			expectedErr: "invalid path pattern '/users/{id' under prefix '/api': unclosed '{' in segment '{id'",
+		},
+		{
+			name: "invalid path pattern constraint",
+			cfg: &RouteConfig{
+				Prefix: "/api",
+				Paths:  []*PathConfig{{Path: "/users/{id:[0-9+}", Method: "GET", ProxyTarget: "http://localhost:8080"}},
+			},
+			expectedErr: "invalid path pattern '/users/{id:[0-9+}' under prefix '/api': invalid constraint of parameter 'id': error parsing regexp: missing closing ]: `[0-9+`",
+		},
+		{
+			name: "path pattern as prefix",
+			cfg: &RouteConfig{
+				Prefix:      "/tenants/{tenant}",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+			},
+			expectedErr: "prefix '/tenants/{tenant}' cannot be a path pattern, patterns are only supported in 'path'",
+		},
+		{
+			name: "path pattern shadowed by unconstrained pattern",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				Routes: []*RouteConfig{{
+					Prefix: "/api",
+					Method: "GET",
+					Paths: []*PathConfig{
+						{Path: "/users/{name}", ProxyTarget: "http://localhost:8080"},
+						{Path: "/users/{id:[0-9]+}", ProxyTarget: "http://localhost:8081"},
+					},
+				}},
+			},
+			expectedErr: "path pattern '/api/users/{id:[0-9]+}' conflicts with '/api/users/{name}' defined before it",
+		},
+		{
+			name: "path pattern defined twice in domain route",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				DomainRoutes: []*DomainRouteConfig{{
+					Domain:      "example.com",
+					ProxyTarget: "http://localhost:8080",
+					Paths: []*DomainPathConfig{
+						{Path: "/files/*.json", Method: "GET"},
+						{Path: "/files/*.json", Method: "GET"},
+					},
+				}},
+			},
+			expectedErr: "path pattern '/files/*.json' conflicts with '/files/*.json' defined before it in domain route 'example.com'",
+		},
+		{
+			name: "literal path next to glob path of the same prefix",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				Routes: []*RouteConfig{{
+					Prefix: "/files",
+					Method: "GET",
+					Paths: []*PathConfig{
+						{Path: "/**", ProxyTarget: "http://localhost:8080"},
+						{Path: "/list", ProxyTarget: "http://localhost:8081"},
+					},
+				}},
+			},
+			expectedErr: "path '/list' of route '/files' conflicts with another route: '/list/*path' in new path '/files/list/*path' conflicts with existing wildcard '/*p1' in existing prefix '/files/*p1'",
+		},
+		{
+			name: "literal path next to parameter path of the same prefix",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				Routes: []*RouteConfig{{
+					Prefix: "/users",
+					Method: "GET",
+					Paths: []*PathConfig{
+						{Path: "/{id}", ProxyTarget: "http://localhost:8080"},
+						{Path: "/me", ProxyTarget: "http://localhost:8081"},
+					},
+				}},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "constrained path pattern before unconstrained one",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				Routes: []*RouteConfig{{
+					Prefix: "/api",
+					Method: "GET",
+					Paths: []*PathConfig{
+						{Path: "/users/{id:[0-9]+}", ProxyTarget: "http://localhost:8081"},
+						{Path: "/users/{name}", ProxyTarget: "http://localhost:8080"},
+						{Path: "/users/{name}", RedirectTarget: "https://example.com", RedirectCode: 302},
+					},
+				}},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "match rule without name",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Match:       &MatchConfig{Headers: []*MatchRuleConfig{{Equals: "canary"}}},
+			},
+			expectedErr: "'name' is missing in header match rule",
+		},
+		{
+			name: "match rule with equals and regex",
+			cfg: &RouteConfig{
+				Prefix: "/api",
+				Paths: []*PathConfig{{
+					Path:        "/users",
+					Method:      "GET",
+					ProxyTarget: "http://localhost:8080",
+					Match:       &MatchConfig{Query: []*MatchRuleConfig{{Name: "version", Equals: "2", Regex: "^2"}}},
+				}},
+			},
+			expectedErr: "query match rule 'version' cannot define both 'equals' and 'regex'",
+		},
+		{
+			name: "match rule with invalid regex",
+			cfg: &DomainRouteConfig{
+				Domain:      "example.com",
+				ProxyTarget: "http://localhost:8080",
+				Match:       &MatchConfig{Cookies: []*MatchRuleConfig{{Name: "group", Regex: "(beta"}}},
+			},
+			expectedErr: "invalid 'regex' '(beta' in cookie match rule 'group': error parsing regexp: missing closing ): `(beta`",
+		},
+		{
+			name: "match with invalid client cidr",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Match:       &MatchConfig{ClientCIDRs: []string{"10.0.0.0/33"}},
+			},
+			expectedErr: "invalid ip range '10.0.0.0/33' in 'client_cidrs' of match",
+		},
+		{
+			name: "path pattern after the same pattern with match",
+			cfg: &Config{
+				Env: &EnvConfig{},
+				Routes: []*RouteConfig{{
+					Prefix: "/api",
+					Method: "GET",
+					Paths: []*PathConfig{
+						{Path: "/users/{id}", ProxyTarget: "http://localhost:8081", Match: &MatchConfig{Headers: []*MatchRuleConfig{{Name: "X-Canary"}}}},
+						{Path: "/users/{id}", ProxyTarget: "http://localhost:8080"},
+					},
+				}},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "targets with proxy_target",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Targets:     []*WeightedTargetConfig{{URL: "http://localhost:8081", Weight: 1}},
+			},
+			expectedErr: "base route with both 'proxy_target' and 'targets' defined is not allowed",
+		},
+		{
+			name: "targets with zero total weight",
+			cfg: &RouteConfig{
+				Prefix:  "/api",
+				Method:  "GET",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080"}, {URL: "http://localhost:8081"}},
+			},
+			expectedErr: "the weights of the targets of base route must sum up to more than 0",
+		},
+		{
+			name: "target with negative weight",
+			cfg: &DomainRouteConfig{
+				Domain:  "example.com",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: -1}},
+			},
+			expectedErr: "invalid weight -1 of target 'http://localhost:8080' in domain route 'example.com'. Weight must not be negative",
+		},
+		{
+			name: "sticky without targets",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Sticky:      &StickyConfig{Cookie: "canary"},
+			},
+			expectedErr: "'sticky' defined without 'targets' in base route",
+		},
+		{
+			name: "sticky without cookie or header",
+			cfg: &RouteConfig{
+				Prefix:  "/api",
+				Method:  "GET",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: 1}},
+				Sticky:  &StickyConfig{},
+			},
+			expectedErr: "'sticky' in base route needs exactly one of 'cookie', 'hash_cookie', 'header' or 'client_ip'",
+		},
+		{
+			name: "sticky with several modes",
+			cfg: &DomainRouteConfig{
+				Domain:  "example.com",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: 1}},
+				Sticky:  &StickyConfig{Cookie: "affinity", ClientIP: true},
+			},
+			expectedErr: "'sticky' in domain route 'example.com' needs exactly one of 'cookie', 'hash_cookie', 'header' or 'client_ip'",
+		},
+		{
+			name: "health check without targets",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				HealthCheck: &HealthCheckConfig{Path: "/healthz"},
+			},
+			expectedErr: "'health_check' defined without 'targets' in base route",
+		},
+		{
+			name: "health check path without leading slash",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				Targets:     []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: 1}},
+				HealthCheck: &HealthCheckConfig{Path: "healthz"},
+			},
+			expectedErr: "invalid 'path' 'healthz' of health check in base route. Path must start with '/'",
+		},
+		{
+			name: "targets with paths",
+			cfg: &RouteConfig{
+				Prefix:  "/api",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: 1}},
+				Paths:   []*PathConfig{{Path: "/users", Method: "GET", ProxyTarget: "http://localhost:8080"}},
+			},
+			expectedErr: "base route with defined 'proxy_target' url is not allowed to have paths",
+		},
+		{
+			name: "valid weighted domain route",
+			cfg: &DomainRouteConfig{
+				Domain:  "example.com",
+				Targets: []*WeightedTargetConfig{{URL: "http://localhost:8080", Weight: 95}, {URL: "http://localhost:8081", Weight: 5}},
+				Sticky:  &StickyConfig{Header: "X-User-Id"},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "mirror without target",
+			cfg: &RouteConfig{
+				Prefix:      "/api",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Mirror:      &MirrorConfig{},
+			},
+			expectedErr: "required field 'target' is missing for mirror",
+		},
+		{
+			name: "mirror with invalid percentage",
+			cfg: &RouteConfig{
+				Prefix: "/api",
+				Paths: []*PathConfig{{
+					Path:        "/users",
+					Method:      "POST",
+					ProxyTarget: "http://localhost:8080",
+					Mirror:      &MirrorConfig{Target: "http://localhost:9090", Percentage: 150},
+				}},
+			},
+			expectedErr: "invalid 'percentage' 150 for mirror. Percentage must be in the range of 0-100",
+		},
+		{
+			name: "mirror on redirect path",
+			cfg: &RouteConfig{
+				Prefix: "/api",
+				Paths: []*PathConfig{{
+					Path:           "/old",
+					Method:         "GET",
+					RedirectTarget: "https://example.com",
+					RedirectCode:   301,
+					Mirror:         &MirrorConfig{Target: "http://localhost:9090"},
+				}},
+			},
+			expectedErr: "'mirror' is only supported for proxy routes, not for path route with 'redirect_target'",
+		},
+		{
+			name: "valid websocket limits",
+			cfg: &RouteConfig{
+				Prefix:      "/ws",
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				WebSocket:   &WebSocketConfig{MaxConnections: 100, IdleTimeout: time.Minute, MaxLifetime: time.Hour},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "websocket with negative max connections",
+			cfg: &DomainRouteConfig{
+				Domain:      "example.com",
+				ProxyTarget: "http://localhost:8080",
+				WebSocket:   &WebSocketConfig{MaxConnections: -1},
+			},
+			expectedErr: "invalid 'max_connections' -1 for websocket. Max connections must not be negative",
+		},
+		{
+			name: "websocket on redirect route",
+			cfg: &RouteConfig{
+				Prefix:         "/ws",
+				Method:         "GET",
+				RedirectTarget: "https://example.com",
+				RedirectCode:   302,
+				WebSocket:      &WebSocketConfig{IdleTimeout: time.Minute},
+			},
+			expectedErr: "'websocket' is only supported for proxy routes, not for base route with 'redirect_target'",
+		},
+		{
+			name: "grpc_web on route without POST",
+			cfg: &RouteConfig{
+				Prefix:      "/echo.Echo",
+				Methods:     []string{"GET", "PUT"},
+				ProxyTarget: "http://localhost:9000",
+				GRPCWeb:     true,
+			},
+			expectedErr: "route '/echo.Echo' with 'grpc_web' must serve POST requests",
+		},
+		{
+			name: "grpc_web on redirect route",
+			cfg: &RouteConfig{
+				Prefix:         "/echo.Echo",
+				Method:         "POST",
+				RedirectTarget: "https://example.com",
+				RedirectCode:   307,
+				GRPCWeb:        true,
+			},
+			expectedErr: "'grpc_web' is only supported for proxy routes, not for base route with 'redirect_target'",
+		},
 		{
 			name: "redirect_code without redirect_target at base",
 			cfg: &RouteConfig{
@@ -381,6 +1031,135 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErr: "",
 		},
+		{
+			name:        "invalid http3 port",
+			cfg:         &EnvConfig{HTTP3Port: 70000, CertFilepath: "cert.pem", KeyFilepath: "key.pem"},
+			expectedErr: "invalid 'HTTP3_PORT'. Port number must be in the range of 0-65535",
+		},
+		{
+			name:        "http3 port without tls",
+			cfg:         &EnvConfig{HTTP3Port: 8443},
+			expectedErr: "'HTTP3_PORT' requires 'CERT_FILEPATH' and 'KEY_FILEPATH' to be defined",
+		},
+		{
+			name: "listener with default name",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{"default": {Port: 9000}},
+			},
+			expectedErr: "listener name 'default' is reserved for the listener of 'HOST' and 'PORT'",
+		},
+		{
+			name: "listener without port",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{"internal": {}},
+			},
+			expectedErr: "invalid 'port' 0 of listener 'internal'. Port number must be in the range of 1-65535",
+		},
+		{
+			name: "listener with cert but no key",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{"public": {Port: 443, CertFilepath: "cert.pem"}},
+			},
+			expectedErr: "listener 'public' must define both 'cert_filepath' and 'key_filepath' or neither",
+		},
+		{
+			name: "redirect listener with tls",
+			cfg: &Config{
+				Env: &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{
+					"redirect": {Port: 80, RedirectHTTPS: true, CertFilepath: "cert.pem", KeyFilepath: "key.pem"},
+				},
+			},
+			expectedErr: "listener 'redirect' with 'redirect_https' cannot serve TLS",
+		},
+		{
+			name: "listener on port of default listener",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{"internal": {Port: 8080}},
+			},
+			expectedErr: "listener 'internal' uses port 8080 of listener 'default'",
+		},
+		{
+			name: "route with unknown listener",
+			cfg: &Config{
+				Env:    &EnvConfig{Port: 8080},
+				Routes: []*RouteConfig{{Prefix: "/api", Method: "GET", ProxyTarget: "http://localhost:8081", Listeners: []string{"internal"}}},
+			},
+			expectedErr: "unknown listener 'internal' in route '/api'",
+		},
+		{
+			name: "domain route on redirect listener",
+			cfg: &Config{
+				Env:          &EnvConfig{Port: 8080},
+				Listeners:    map[string]*ListenerConfig{"redirect": {Port: 80, RedirectHTTPS: true}},
+				DomainRoutes: []*DomainRouteConfig{{Domain: "example.com", ProxyTarget: "http://localhost:8081", Listeners: []string{"redirect"}}},
+			},
+			expectedErr: "listener 'redirect' with 'redirect_https' cannot serve domain route 'example.com'",
+		},
+		{
+			name: "valid listeners",
+			cfg: &Config{
+				Env: &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{
+					"public":   {Port: 443, CertFilepath: "cert.pem", KeyFilepath: "key.pem"},
+					"redirect": {Port: 80, RedirectHTTPS: true},
+				},
+				Routes: []*RouteConfig{{Prefix: "/api", Method: "GET", ProxyTarget: "http://localhost:8081", Listeners: []string{"default", "public"}}},
+			},
+			expectedErr: "",
+		},
+		{
+			name: "admin api without token",
+			cfg: &Config{
+				Env:   &EnvConfig{Port: 8080},
+				Admin: &AdminConfig{Port: 9090},
+			},
+			expectedErr: "'token' is missing for admin api",
+		},
+		{
+			name: "admin api with key but no cert",
+			cfg: &Config{
+				Env:   &EnvConfig{Port: 8080},
+				Admin: &AdminConfig{Port: 9090, Token: "secret", KeyFilepath: "key.pem"},
+			},
+			expectedErr: "admin api must define both 'cert_filepath' and 'key_filepath' or neither",
+		},
+		{
+			name: "admin api on port of listener",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080},
+				Listeners: map[string]*ListenerConfig{"internal": {Port: 9090}},
+				Admin:     &AdminConfig{Port: 9090, Token: "secret"},
+			},
+			expectedErr: "admin api uses port 9090 of listener 'internal'",
+		},
+		{
+			name:        "metrics path without metrics port",
+			cfg:         &EnvConfig{Port: 8080, MetricsPath: "/metrics"},
+			expectedErr: "'METRICS_PATH' requires 'METRICS_PORT', metrics are served on a listener of their own",
+		},
+		{
+			name:        "metrics on the port of the routes",
+			cfg:         &EnvConfig{Port: 8080, MetricsPort: 8080, MetricsPath: "/metrics"},
+			expectedErr: "'METRICS_PORT' cannot be the same as 'PORT', metrics are served on a listener of their own",
+		},
+		{
+			name: "listener on the metrics port",
+			cfg: &Config{
+				Env:       &EnvConfig{Port: 8080, MetricsPort: 9100, MetricsPath: "/metrics"},
+				Listeners: map[string]*ListenerConfig{"internal": {Port: 9100}},
+			},
+			expectedErr: "listener 'internal' uses port 9100 of the metrics listener",
+		},
+		{
+			name:        "valid http3 port",
+			cfg:         &EnvConfig{HTTP3Port: 8443, CertFilepath: "cert.pem", KeyFilepath: "key.pem"},
+			expectedErr: "",
+		},
 	}
 
 	for _, tc := range testCases {
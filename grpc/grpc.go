@@ -0,0 +1,122 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+)
+
+// Status codes of the gRPC protocol used by the gateway
+const (
+	CodeOK                = 0
+	CodeUnknown           = 2
+	CodeDeadlineExceeded  = 4
+	CodePermissionDenied  = 7
+	CodeResourceExhausted = 8
+	CodeUnimplemented     = 12
+	CodeInternal          = 13
+	CodeUnavailable       = 14
+	CodeUnauthenticated   = 16
+)
+
+// IsGRPC reports whether req is a gRPC call
+func IsGRPC(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	return contentType == contentTypeGRPC || strings.HasPrefix(contentType, contentTypeGRPC+"+") ||
+		strings.HasPrefix(contentType, contentTypeGRPC+";")
+}
+
+// CodeFromHTTP maps the http status of a rejection to a gRPC status code,
+// following the mapping of the gRPC specification. Limits rejected by the
+// gateway are reported as exhausted resources rather than unavailable.
+func CodeFromHTTP(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInternal
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound:
+		return CodeUnimplemented
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return CodeDeadlineExceeded
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return CodeResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeUnknown
+	}
+}
+
+// Abort ends a gRPC call rejected by the gateway with a trailers-only
+// response, the status travels in the headers as gRPC clients expect it
+// instead of in an http status and a JSON body
+func Abort(c *gin.Context, status int, message string) {
+	contentType := contentTypeGRPC
+	if IsGRPCWeb(c.Request) {
+		contentType = contentTypeWeb
+		if strings.HasPrefix(c.Request.Header.Get("Content-Type"), contentTypeWebText) {
+			contentType = contentTypeWebText
+		}
+	}
+
+	writeStatus(c.Writer, contentType, CodeFromHTTP(status), message)
+	c.Abort()
+}
+
+// WriteStatus writes a trailers-only response with the gRPC status code
+func WriteStatus(w http.ResponseWriter, code int, message string) {
+	writeStatus(w, contentTypeGRPC, code, message)
+}
+
+func writeStatus(w http.ResponseWriter, contentType string, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeMessage percent-encodes the bytes a grpc-message header cannot carry
+func encodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		ch := message[i]
+		if ch < ' ' || ch > '~' || ch == '%' {
+			fmt.Fprintf(&b, "%%%02X", ch)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// h2cTransport speaks HTTP/2 without TLS to plain http upstreams
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	},
+}
+
+// Transport returns the transport proxying gRPC calls to target. gRPC needs
+// HTTP/2, which plain http upstreams are spoken to with prior knowledge while
+// https upstreams negotiate it.
+func Transport(target *url.URL) http.RoundTripper {
+	if target.Scheme == "http" {
+		return h2cTransport
+	}
+	return http.DefaultTransport
+}
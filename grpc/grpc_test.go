@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsGRPC(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		expected    bool
+	}{
+		{contentType: "application/grpc", expected: true},
+		{contentType: "application/grpc+proto", expected: true},
+		{contentType: "application/grpc;charset=utf-8", expected: true},
+		{contentType: "application/grpc-web", expected: false},
+		{contentType: "application/json", expected: false},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Content-Type", tc.contentType)
+		if IsGRPC(req) != tc.expected {
+			t.Errorf("Expected IsGRPC of %q to be %v", tc.contentType, tc.expected)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	testCases := []struct {
+		status       int
+		expectedCode string
+	}{
+		{status: http.StatusUnauthorized, expectedCode: "16"},
+		{status: http.StatusForbidden, expectedCode: "7"},
+		{status: http.StatusTooManyRequests, expectedCode: "8"},
+		{status: http.StatusServiceUnavailable, expectedCode: "14"},
+		{status: http.StatusTeapot, expectedCode: "2"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", nil)
+		c.Request.Header.Set("Content-Type", "application/grpc")
+		Abort(c, tc.status, "rejected: 100% sure")
+
+		if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != tc.expectedCode {
+			t.Errorf("Expected status %d to be rejected with grpc-status %s, got %d with %q",
+				tc.status, tc.expectedCode, w.Code, w.Header().Get("Grpc-Status"))
+		}
+		if message := w.Header().Get("Grpc-Message"); message != "rejected: 100%25 sure" {
+			t.Errorf("Expected a percent-encoded grpc-message, got %q", message)
+		}
+		if !c.IsAborted() {
+			t.Error("Expected the request to be aborted")
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	contentTypeGRPC    = "application/grpc"
+	contentTypeWeb     = "application/grpc-web"
+	contentTypeWebText = "application/grpc-web-text"
+)
+
+// WebHeaders are the request headers of gRPC-Web clients that a CORS
+// preflight has to allow
+var WebHeaders = []string{"Content-Type", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout"}
+
+// WebExposeHeaders are the response headers gRPC-Web clients read the status
+// of a call from when it is sent without trailers
+var WebExposeHeaders = []string{"Grpc-Status", "Grpc-Message"}
+
+// IsGRPCWeb reports whether req is a gRPC-Web call, binary or text encoded
+func IsGRPCWeb(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), contentTypeWeb)
+}
+
+// IsCall reports whether req is a gRPC or gRPC-Web call, which expect the
+// gRPC status of a rejection instead of an http status
+func IsCall(req *http.Request) bool {
+	return IsGRPC(req) || IsGRPCWeb(req)
+}
+
+// ServeWeb translates a gRPC-Web call into a native gRPC call for proxy and
+// the gRPC response back into gRPC-Web: the trailers of the upstream are sent
+// as the last frame of the body, and text calls are base64 encoded both ways.
+// Other requests are proxied unchanged.
+func ServeWeb(c *gin.Context, proxy func()) {
+	if !IsGRPCWeb(c.Request) {
+		proxy()
+		return
+	}
+
+	contentType := c.Request.Header.Get("Content-Type")
+	webType := contentTypeWeb
+	if strings.HasPrefix(contentType, contentTypeWebText) {
+		webType = contentTypeWebText
+	}
+
+	c.Request.Header.Set("Content-Type", contentTypeGRPC+strings.TrimPrefix(contentType, webType))
+	c.Request.Header.Set("Te", "trailers")
+	c.Request.Header.Del("X-Grpc-Web")
+	if webType == contentTypeWebText {
+		c.Request.Body = &base64Reader{r: c.Request.Body}
+		c.Request.ContentLength = -1
+		c.Request.Header.Del("Content-Length")
+	}
+
+	original := c.Writer
+	w := &webWriter{ResponseWriter: original, header: make(http.Header), webType: webType}
+	c.Writer = w
+	defer func() { c.Writer = original }()
+
+	proxy()
+	w.writeTrailers()
+}
+
+// webWriter collects the headers and trailers of the gRPC response apart from
+// the ones set by the gateway, so that the trailers can be moved into the body
+type webWriter struct {
+	gin.ResponseWriter
+	header       http.Header
+	webType      string
+	wroteHeader  bool
+	grpcResponse bool
+	announced    []string
+}
+
+func (w *webWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *webWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	for _, names := range w.header.Values("Trailer") {
+		for _, name := range strings.Split(names, ",") {
+			w.announced = append(w.announced, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+		}
+	}
+
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		if key == "Trailer" || strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		header[key] = values
+	}
+
+	if contentType := header.Get("Content-Type"); strings.HasPrefix(contentType, contentTypeGRPC) {
+		w.grpcResponse = true
+		header.Set("Content-Type", w.webType+strings.TrimPrefix(contentType, contentTypeGRPC))
+		header.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *webWriter) WriteHeaderNow() {
+	w.WriteHeader(w.ResponseWriter.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *webWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.webType != contentTypeWebText || !w.grpcResponse {
+		return w.ResponseWriter.Write(data)
+	}
+
+	// Every write is encoded on its own, gRPC-Web clients decode the
+	// concatenated padded chunks
+	if _, err := w.ResponseWriter.WriteString(base64.StdEncoding.EncodeToString(data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *webWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// writeTrailers sends the trailers of the upstream as a frame flagged 0x80,
+// made of lower case header lines. Trailers-only responses keep the status in
+// the headers, which gRPC-Web clients read too.
+func (w *webWriter) writeTrailers() {
+	if !w.grpcResponse {
+		return
+	}
+
+	trailer := make(http.Header)
+	for _, key := range w.announced {
+		if values, ok := w.header[key]; ok {
+			trailer[key] = values
+		}
+	}
+	for key, values := range w.header {
+		if name, ok := strings.CutPrefix(key, http.TrailerPrefix); ok {
+			trailer[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	if len(trailer) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var block bytes.Buffer
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			block.WriteString(strings.ToLower(key) + ": " + value + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	w.Write(append(frame, block.Bytes()...))
+	w.Flush()
+}
+
+// base64Reader decodes the body of gRPC-Web text calls. Clients may send it
+// as several padded chunks, so every group of four characters is decoded on
+// its own.
+type base64Reader struct {
+	r       io.Reader
+	buf     [4096]byte
+	pending []byte
+	decoded []byte
+	err     error
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.decoded) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		n, err := b.r.Read(b.buf[:])
+		b.pending = append(b.pending, b.buf[:n]...)
+		groups := len(b.pending) / 4 * 4
+		for i := 0; i < groups; i += 4 {
+			var out [3]byte
+			m, decodeErr := base64.StdEncoding.Decode(out[:], b.pending[i:i+4])
+			if decodeErr != nil {
+				b.err = decodeErr
+				break
+			}
+			b.decoded = append(b.decoded, out[:m]...)
+		}
+		b.pending = append(b.pending[:0], b.pending[groups:]...)
+
+		if err != nil && b.err == nil {
+			b.err = err
+			if err == io.EOF && len(b.pending) != 0 {
+				b.err = io.ErrUnexpectedEOF
+			}
+		}
+	}
+
+	n := copy(p, b.decoded)
+	b.decoded = b.decoded[n:]
+	return n, nil
+}
+
+func (b *base64Reader) Close() error {
+	if closer, ok := b.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBase64Reader(t *testing.T) {
+	testCases := []struct {
+		name        string
+		body        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "single chunk", body: base64.StdEncoding.EncodeToString([]byte("hello world")), expected: "hello world"},
+		{name: "padded chunks", body: base64.StdEncoding.EncodeToString([]byte("he")) + base64.StdEncoding.EncodeToString([]byte("llo")), expected: "hello"},
+		{name: "truncated", body: "aGVsbG", expectedErr: true},
+		{name: "invalid", body: "a$$a", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// One byte at a time splits the groups between reads
+			r := &base64Reader{r: io.NopCloser(&oneByteReader{strings.NewReader(tc.body)})}
+			decoded, err := io.ReadAll(r)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("Expected an error decoding %q", tc.body)
+				}
+				return
+			}
+			if err != nil || string(decoded) != tc.expected {
+				t.Fatalf("Expected %q, got %q (%v)", tc.expected, decoded, err)
+			}
+		})
+	}
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	return r.r.Read(p[:1])
+}
+
+func TestAbortGRPCWeb(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", nil)
+	c.Request.Header.Set("Content-Type", "application/grpc-web-text")
+
+	Abort(c, http.StatusUnauthorized, "unauthorized")
+	if w.Header().Get("Content-Type") != "application/grpc-web-text" || w.Header().Get("Grpc-Status") != "16" {
+		t.Errorf("Expected a gRPC-Web text status, got %q with grpc-status %q", w.Header().Get("Content-Type"), w.Header().Get("Grpc-Status"))
+	}
+}
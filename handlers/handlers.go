@@ -1,7 +1,10 @@
 package handlers
 
 import (
-	"cloud_gateway/route"
+	"cloud_gateway/cache"
+	"cloud_gateway/grpc"
+	"cloud_gateway/metrics"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -20,10 +23,15 @@ func ProxyRequestHandler(c *gin.Context, target, targetPath string) {
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	isGRPC := grpc.IsGRPC(c.Request)
+	if isGRPC {
+		proxy.Transport = grpc.Transport(targetURL)
+	}
 
 	proxy.Director = func(req *http.Request) {
 		// Modify request parameters
-		req.URL.Path = targetURL.Path + targetPath
+		req.URL.Path = strings.TrimSuffix(targetURL.Path, "/") + targetPath
+		req.URL.RawPath = ""
 		req.Host = targetURL.Host
 		req.URL.Host = targetURL.Host
 		req.URL.Scheme = targetURL.Scheme
@@ -35,49 +43,91 @@ func ProxyRequestHandler(c *gin.Context, target, targetPath string) {
 		log.Printf("[PROXY] X-Forwarded-Host: %s", req.Header.Get("X-Forwarded-Host"))
 	}
 
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// The request body was cut off by a body limit
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			if isGRPC {
+				grpc.WriteStatus(w, grpc.CodeResourceExhausted, "request body too large")
+				return
+			}
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		log.Printf("[PROXY] Proxy error for %s: %v", req.URL, err)
+		if isGRPC {
+			grpc.WriteStatus(w, grpc.CodeUnavailable, "upstream unavailable")
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
 	log.Printf("[PROXY] Request received at %s at %s\n", c.Request.URL, time.Now())
 	log.Printf("[PROXY] Target URL: %s", targetURL)
 
 	proxy.ServeHTTP(c.Writer, c.Request)
-}
 
-func RedirectHandler(c *gin.Context, url string, code int) {
-	c.Redirect(code, url)
+	// Send the headers of responses without a body through c.Writer, so that
+	// middleware wrapping it sees them too
+	c.Writer.WriteHeaderNow()
 }
 
-func DomainProxyHandler(c *gin.Context, routes []route.DomainRoute) {
-	targetDomain := strings.Split(c.Request.Host, ":")[0]
-	reqPath := c.Request.URL.Path
-	reqMethod := c.Request.Method
+func MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WritePrometheus(c.Writer)
+}
 
-	for _, r := range routes {
-		if r.Domain != targetDomain {
-			continue
+// CachePurgeHandler removes entries from the response caches. The cache query
+// parameter limits the purge to a single cache and prefix to the keys, made of
+// host and request URI, starting with it.
+func CachePurgeHandler(c *gin.Context) {
+	prefix := c.Query("prefix")
+
+	stores := cache.All()
+	if name := c.Query("cache"); name != "" {
+		store, ok := cache.Lookup(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown cache"})
+			return
 		}
+		stores = map[string]*cache.Store{name: store}
+	}
 
-		// Apply middlware
-		for _, mw := range r.Middleware {
-			mw(c)
-			if c.IsAborted() {
-				return
-			}
-		}
+	purged := 0
+	for _, store := range stores {
+		purged += store.Purge(prefix)
+	}
 
-		for _, p := range r.Paths {
-			if p.Path != reqPath || p.Method != reqMethod {
-				continue
-			}
-			for _, pmw := range p.Middleware {
-				pmw(c)
-				if c.IsAborted() {
-					return
-				}
-			}
-		}
+	log.Printf("[CACHE] Purged %d entries with prefix '%s'", purged, prefix)
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
 
-		ProxyRequestHandler(c, r.ProxyTarget, reqPath)
+func RedirectHandler(c *gin.Context, url string, code int) {
+	c.Redirect(code, url)
+	c.Writer.WriteHeaderNow()
+}
+
+// DomainProxyHandler dispatches the request to the handler of its domain.
+// Every domain has its own handler so that its middleware run as a regular
+// gin handler chain around the proxy.
+func DomainProxyHandler(c *gin.Context, domainHandlers map[string]http.Handler) {
+	targetDomain := strings.Split(c.Request.Host, ":")[0]
+
+	handler, ok := domainHandlers[targetDomain]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no backend found for domain"})
 		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "no backend found for domain"})
+	ServeNested(c, handler, c.Request)
+}
+
+// ServeNested serves a request with an engine nested in the one of c. The
+// nested engine completes responses without a body on its own writer, so the
+// headers are then sent through c.Writer for the middleware wrapping it.
+func ServeNested(c *gin.Context, handler http.Handler, req *http.Request) {
+	handler.ServeHTTP(c.Writer, req)
+	c.Writer.WriteHeaderNow()
 }
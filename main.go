@@ -1,13 +1,25 @@
 package main
 
 import (
+	"cloud_gateway/admin"
 	"cloud_gateway/config"
+	"cloud_gateway/handlers"
 	"cloud_gateway/registry"
+	"cloud_gateway/server"
+	_ "embed"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 )
 
+//go:embed VERSION
+var version string
+
 func main() {
 	env, err := config.LoadEnv()
 	if err != nil {
@@ -22,12 +34,28 @@ func main() {
 	}
 
 	gin.SetMode(cfg.Env.GinMode)
-	r := gin.Default()
-	r.SetTrustedProxies(cfg.Env.TrustedProxies)
 	rr := &registry.RouteRegistry{}
 	rr.FromConfig(cfg)
-	rr.RegisterRoutes(r)
-	rr.RegisterDomainRoutes(r)
+
+	var global []gin.HandlerFunc
+	if cfg.Env.HTTP3Port != 0 {
+		global = append(global, server.AltSvc(cfg.Env.HTTP3Port))
+	}
+	r := newEngine(cfg, rr.ForListener(config.DefaultListener), global...)
+
+	for name, listenerCfg := range cfg.Listeners {
+		go serveListener(name, listenerCfg, cfg, rr)
+	}
+
+	if cfg.Admin != nil {
+		go serveAdmin(cfg, rr)
+	}
+
+	if cfg.Env.MetricsPort != 0 {
+		go serveMetrics(cfg)
+	}
+
+	go reloadOnSignal(env)
 
 	addr := fmt.Sprintf("%s:%v", cfg.Env.Host, cfg.Env.Port)
 	certFilepath := cfg.Env.CertFilepath
@@ -35,8 +63,87 @@ func main() {
 	if certFilepath == "" || keyFilepath == "" {
 		r.Run(addr)
 	} else {
-
+		if cfg.Env.HTTP3Port != 0 {
+			go func() {
+				http3Addr := fmt.Sprintf("%s:%v", cfg.Env.Host, cfg.Env.HTTP3Port)
+				log.Fatalf("[ERROR] HTTP/3 listener on %s stopped: %v", http3Addr,
+					server.ListenHTTP3(http3Addr, certFilepath, keyFilepath, r))
+			}()
+		}
 		r.RunTLS(addr, certFilepath, keyFilepath)
 	}
 
 }
+
+// newEngine returns an engine serving the routes of rr, after the global
+// middleware
+func newEngine(cfg *config.Config, rr *registry.RouteRegistry, global ...gin.HandlerFunc) *gin.Engine {
+	r := gin.Default()
+	// Clients may speak HTTP/2 without TLS, e.g. gRPC clients. With TLS it is
+	// negotiated by the server.
+	r.UseH2C = true
+	r.SetTrustedProxies(cfg.Env.TrustedProxies)
+	r.Use(global...)
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	return r
+}
+
+// serveListener runs an additional listener with the routes naming it, or
+// redirecting all of its requests to https
+func serveListener(name string, listenerCfg *config.ListenerConfig, cfg *config.Config, rr *registry.RouteRegistry) {
+	addr := fmt.Sprintf("%s:%v", listenerCfg.Host, listenerCfg.Port)
+
+	var err error
+	switch {
+	case listenerCfg.RedirectHTTPS:
+		err = http.ListenAndServe(addr, server.RedirectHTTPS(listenerCfg.HTTPSPort))
+	case listenerCfg.CertFilepath != "":
+		err = newEngine(cfg, rr.ForListener(name)).RunTLS(addr, listenerCfg.CertFilepath, listenerCfg.KeyFilepath)
+	default:
+		err = newEngine(cfg, rr.ForListener(name)).Run(addr)
+	}
+	log.Fatalf("[ERROR] Listener '%s' on %s stopped: %v", name, addr, err)
+}
+
+// serveAdmin runs the admin api on its own listener, reporting the routes of
+// every listener
+func serveAdmin(cfg *config.Config, rr *registry.RouteRegistry) {
+	addr := fmt.Sprintf("%s:%v", cfg.Admin.Host, cfg.Admin.Port)
+	r := admin.NewEngine(cfg, rr, admin.NewBuild(version))
+
+	var err error
+	if cfg.Admin.CertFilepath != "" {
+		err = r.RunTLS(addr, cfg.Admin.CertFilepath, cfg.Admin.KeyFilepath)
+	} else {
+		err = r.Run(addr)
+	}
+	log.Fatalf("[ERROR] Admin api on %s stopped: %v", addr, err)
+}
+
+// serveMetrics runs the listener of the metrics, apart from the routes so
+// that it can be kept from the public
+func serveMetrics(cfg *config.Config) {
+	addr := fmt.Sprintf("%s:%v", cfg.Env.Host, cfg.Env.MetricsPort)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET(cfg.Env.MetricsPath, handlers.MetricsHandler)
+
+	log.Fatalf("[ERROR] Metrics listener on %s stopped: %v", addr, r.Run(addr))
+}
+
+// reloadOnSignal reloads the config file on SIGHUP and applies the weighted
+// targets of its routes. An invalid config leaves the running one untouched.
+func reloadOnSignal(env config.Env) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		cfg, err := config.LoadConfig(env.ConfigFilepath, env.ConfigFileType)
+		if err != nil {
+			log.Printf("[RELOAD] Keeping the running config: %v", err)
+			continue
+		}
+		registry.ReloadTargets(cfg)
+	}
+}
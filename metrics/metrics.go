@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics are identified by a name and optional label pairs given as
+// alternating keys and values, e.g. IncCounter("requests_total", "route", "/foo").
+// They are kept in a process wide registry and exposed in the Prometheus
+// text format by WritePrometheus.
+
+type metric struct {
+	name   string
+	labels string
+	kind   string
+	value  int64
+}
+
+var (
+	registry = make(map[string]*metric)
+	mu       sync.Mutex
+)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func add(kind, name string, delta int64, labels []string) {
+	formatted := formatLabels(labels)
+	key := name + formatted
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	m, ok := registry[key]
+	if !ok {
+		m = &metric{name: name, labels: formatted, kind: kind}
+		registry[key] = m
+	}
+	m.value += delta
+}
+
+func IncCounter(name string, labels ...string) {
+	add("counter", name, 1, labels)
+}
+
+func AddCounter(name string, delta int64, labels ...string) {
+	add("counter", name, delta, labels)
+}
+
+func AddGauge(name string, delta int64, labels ...string) {
+	add("gauge", name, delta, labels)
+}
+
+// Value returns the current value of a metric, or 0 if it was never recorded
+func Value(name string, labels ...string) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if m, ok := registry[name+formatLabels(labels)]; ok {
+		return m.value
+	}
+	return 0
+}
+
+func WritePrometheus(w io.Writer) {
+	mu.Lock()
+	metrics := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		metrics = append(metrics, *m)
+	}
+	mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].name != metrics[j].name {
+			return metrics[i].name < metrics[j].name
+		}
+		return metrics[i].labels < metrics[j].labels
+	})
+
+	lastName := ""
+	for _, m := range metrics {
+		if m.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+			lastName = m.name
+		}
+		fmt.Fprintf(w, "%s%s %d\n", m.name, m.labels, m.value)
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	IncCounter("test_requests_total", "route", "/foo")
+	IncCounter("test_requests_total", "route", "/foo")
+	IncCounter("test_requests_total", "route", "/bar")
+	AddGauge("test_open_connections", 3)
+	AddGauge("test_open_connections", -1)
+
+	if v := Value("test_requests_total", "route", "/foo"); v != 2 {
+		t.Errorf("Expected counter value: %d, got %d", 2, v)
+	}
+
+	if v := Value("test_unknown_total"); v != 0 {
+		t.Errorf("Expected unknown metric to be 0, got %d", v)
+	}
+
+	var sb strings.Builder
+	WritePrometheus(&sb)
+
+	expected := `# TYPE test_open_connections gauge
+test_open_connections 2
+# TYPE test_requests_total counter
+test_requests_total{route="/bar"} 1
+test_requests_total{route="/foo"} 2
+`
+	if sb.String() != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
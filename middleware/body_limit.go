@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/grpc"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func abortBodyTooLarge(c *gin.Context) {
+	if grpc.IsCall(c.Request) {
+		grpc.Abort(c, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+}
+
+// gzipBody closes both the gzip reader and the original body
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// NewBodyLimitMiddleware rejects request bodies larger than the configured size
+// with 413. Bodies announcing their size are rejected right away, others once
+// reading them goes past the limit. With gzip decompression enabled, gzip
+// encoded bodies are decompressed before they are proxied and the limit
+// applies to the decompressed size.
+func NewBodyLimitMiddleware(cfg *config.BodyLimitConfig) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		if cfg.MaxSize > 0 && c.Request.ContentLength > cfg.MaxSize {
+			abortBodyTooLarge(c)
+			return
+		}
+
+		if cfg.DecompressGzip && strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			reader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				log.Printf("[MIDDLEWARE] invalid gzip request body for %s: %v", c.Request.URL, err)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid gzip request body"})
+				return
+			}
+
+			c.Request.Body = &gzipBody{Reader: reader, body: c.Request.Body}
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.Header.Del("Content-Length")
+			c.Request.ContentLength = -1
+		}
+
+		if cfg.MaxSize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxSize)
+		}
+
+		c.Next()
+	}
+}
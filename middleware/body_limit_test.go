@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"bytes"
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	testCases := []struct {
+		name            string
+		cfg             config.BodyLimitConfig
+		body            []byte
+		contentEncoding string
+		// Hides the length of the body, so that it is sent chunked
+		unknownLength  bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "within limit", cfg: config.BodyLimitConfig{MaxSize: 16}, body: []byte("small body"), expectedStatus: http.StatusOK, expectedBody: "small body"},
+		{name: "content length over limit", cfg: config.BodyLimitConfig{MaxSize: 16}, body: []byte(strings.Repeat("a", 32)), expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked body over limit", cfg: config.BodyLimitConfig{MaxSize: 16}, body: []byte(strings.Repeat("a", 32)), unknownLength: true, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "gzip body decompressed", cfg: config.BodyLimitConfig{MaxSize: 1024, DecompressGzip: true}, body: gzipped("compressed body"), contentEncoding: "gzip", expectedStatus: http.StatusOK, expectedBody: "compressed body"},
+		{name: "decompressed body over limit", cfg: config.BodyLimitConfig{MaxSize: 64, DecompressGzip: true}, body: gzipped(strings.Repeat("a", 1024)), contentEncoding: "gzip", expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "invalid gzip body", cfg: config.BodyLimitConfig{MaxSize: 1024, DecompressGzip: true}, body: []byte("not gzip"), contentEncoding: "gzip", expectedStatus: http.StatusBadRequest},
+		{name: "gzip body kept without decompression", cfg: config.BodyLimitConfig{MaxSize: 1024}, body: gzipped("compressed body"), contentEncoding: "gzip", expectedStatus: http.StatusOK, expectedBody: string(gzipped("compressed body"))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(NewBodyLimitMiddleware(&tc.cfg))
+			r.POST("/upload", func(c *gin.Context) {
+				handlers.ProxyRequestHandler(c, server.URL, "/upload")
+			})
+
+			var body io.Reader = bytes.NewReader(tc.body)
+			if tc.unknownLength {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest("POST", "/upload", body)
+			if tc.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tc.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(&closeNotifyRecorder{w}, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if tc.expectedStatus == http.StatusOK && received != tc.expectedBody {
+				t.Errorf("Expected the upstream to receive %q, got %q", tc.expectedBody, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package middleware
+
+import (
+	"bytes"
+	"cloud_gateway/cache"
+	"cloud_gateway/config"
+	"cloud_gateway/metrics"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the X-Cache response header
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheStale       = "STALE"
+	cacheExpired     = "EXPIRED"
+	cacheRevalidated = "REVALIDATED"
+	cacheBypass      = "BYPASS"
+)
+
+// captureWriter records the response of the handlers after the cache
+// middleware. Headers are kept apart and only copied to the client response
+// when the response is passed through, as responses can also be absorbed: a
+// 304 answering a revalidation of the gateway is replaced by the stored entry
+// and the response of a stale-while-revalidate revalidation is never sent at
+// all.
+type captureWriter struct {
+	gin.ResponseWriter
+	header  http.Header
+	status  int
+	size    int
+	body    bytes.Buffer
+	maxSize int64
+	// tooLarge is set once the body exceeds maxSize, it is not buffered anymore
+	tooLarge bool
+	// validating absorbs a 304, discard absorbs every response
+	validating bool
+	discard    bool
+	// detached responses are completed even when the client goes away
+	detached bool
+	absorbed bool
+	started  bool
+	// passThrough is called with the client response headers before they are sent
+	passThrough func(header http.Header)
+}
+
+func (w *captureWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	if !w.started {
+		w.status = code
+	}
+}
+
+func (w *captureWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	w.absorbed = w.discard || (w.validating && w.status == http.StatusNotModified)
+	if w.absorbed {
+		return
+	}
+
+	header := w.ResponseWriter.Header()
+	for name, values := range w.header {
+		header[name] = values
+	}
+	if w.passThrough != nil {
+		w.passThrough(header)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *captureWriter) WriteHeaderNow() {
+	w.start()
+	if !w.absorbed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.start()
+	w.size += len(data)
+
+	if !w.tooLarge {
+		if int64(w.body.Len()+len(data)) > w.maxSize {
+			w.tooLarge = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(data)
+		}
+	}
+
+	if w.absorbed {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *captureWriter) Flush() {
+	w.start()
+	if !w.absorbed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// CloseNotify keeps detached responses from being cancelled by the reverse
+// proxy when the client goes away
+func (w *captureWriter) CloseNotify() <-chan bool {
+	if w.detached {
+		return make(chan bool)
+	}
+	return w.ResponseWriter.CloseNotify()
+}
+
+func (w *captureWriter) Status() int {
+	return w.status
+}
+
+func (w *captureWriter) Size() int {
+	if !w.started {
+		return -1
+	}
+	return w.size
+}
+
+func (w *captureWriter) Written() bool {
+	return w.started
+}
+
+func recordCacheStatus(name, status string) {
+	metrics.IncCounter("gateway_cache_requests_total", "cache", name, "status", strings.ToLower(status))
+}
+
+// bypassCache reports whether the request must go straight to the upstream:
+// only plain GET and HEAD requests without credentials are served from cache.
+// Cookies count as credentials, responses to them may be personal without
+// saying so.
+func bypassCache(req *http.Request, reqCacheControl map[string]string) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return true
+	}
+
+	if _, ok := reqCacheControl["no-store"]; ok {
+		return true
+	}
+
+	for _, name := range []string{"Authorization", "Cookie", "Range", "Upgrade"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates the conditional headers of the client against an entry
+func notModified(ifNoneMatch, ifModifiedSince string, entry *cache.Entry) bool {
+	if ifNoneMatch != "" {
+		etag := strings.TrimPrefix(entry.Header.Get("ETag"), "W/")
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || (etag != "" && tag == etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(entry.Header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// serveCacheEntry sends a stored response, or 304 when the client already has it
+func serveCacheEntry(c *gin.Context, entry *cache.Entry, status, ifNoneMatch, ifModifiedSince string) {
+	header := c.Writer.Header()
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	header.Set("X-Cache", status)
+
+	if notModified(ifNoneMatch, ifModifiedSince, entry) {
+		header.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	c.Status(entry.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.Write(entry.Body)
+}
+
+// NewCacheMiddleware serves GET and HEAD requests from the store and stores
+// the cacheable upstream responses. Expired entries are revalidated with a
+// conditional request when they have validators. Entries within their
+// stale-while-revalidate window are served right away and revalidated in the
+// background, by the handler of the route on a copy of the request: the
+// middleware after the cache only run for the requests of clients.
+func NewCacheMiddleware(name string, store *cache.Store, cfg *config.CacheConfig) gin.HandlerFunc {
+	policy := cache.Policy{TTL: cfg.TTL, StaleWhileRevalidate: cfg.StaleWhileRevalidate}
+
+	// Keys with a stale-while-revalidate revalidation in progress
+	var revalidating sync.Map
+
+	// fetch asks the upstream through next and stores its response. The
+	// conditional headers of the client are answered by the gateway, the
+	// upstream only sees the validators of the stored entry. In the background
+	// the response is only stored, nothing is sent.
+	fetch := func(c *gin.Context, next func(), key string, entry *cache.Entry, background bool, ifNoneMatch, ifModifiedSince string) {
+		c.Request.Header.Del("If-None-Match")
+		c.Request.Header.Del("If-Modified-Since")
+		validating := entry != nil && entry.Revalidatable()
+		if validating {
+			if etag := entry.Header.Get("ETag"); etag != "" {
+				c.Request.Header.Set("If-None-Match", etag)
+			}
+			if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+				c.Request.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+
+		status := cacheMiss
+		if entry != nil {
+			status = cacheExpired
+		}
+
+		outer := c.Writer
+		writer := &captureWriter{
+			ResponseWriter: outer,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+			maxSize:        cfg.MaxEntrySize,
+			validating:     validating,
+			discard:        background,
+			detached:       background,
+			passThrough: func(header http.Header) {
+				header.Set("X-Cache", status)
+			},
+		}
+		c.Writer = writer
+		next()
+		writer.WriteHeaderNow()
+		c.Writer = outer
+
+		now := time.Now()
+		if writer.absorbed && writer.status == http.StatusNotModified {
+			refreshed, ok := policy.Refresh(entry, writer.header, c.Request.Header, now)
+			if ok {
+				store.Set(refreshed)
+			} else {
+				refreshed = entry
+			}
+
+			if !background {
+				serveCacheEntry(c, refreshed, cacheRevalidated, ifNoneMatch, ifModifiedSince)
+				recordCacheStatus(name, cacheRevalidated)
+			}
+			return
+		}
+
+		if !background {
+			recordCacheStatus(name, status)
+		}
+
+		// The copy of a background revalidation counts as aborted already
+		if c.Request.Method != http.MethodGet || writer.tooLarge || (!background && c.IsAborted()) {
+			return
+		}
+
+		newEntry, ok := policy.NewEntry(key, writer.status, writer.header, writer.body.Bytes(), c.Request.Header, now)
+		if ok {
+			store.Set(newEntry)
+		} else if background {
+			log.Printf("[CACHE] Upstream response for %s is not cacheable anymore", key)
+		}
+	}
+
+	return func(c *gin.Context) {
+		req := c.Request
+		reqCacheControl := cache.ParseCacheControl(req.Header.Get("Cache-Control"))
+
+		if bypassCache(req, reqCacheControl) {
+			c.Header("X-Cache", cacheBypass)
+			recordCacheStatus(name, cacheBypass)
+			c.Next()
+			return
+		}
+
+		key := req.Host + req.URL.RequestURI()
+		ifNoneMatch := req.Header.Get("If-None-Match")
+		ifModifiedSince := req.Header.Get("If-Modified-Since")
+
+		now := time.Now()
+		entry, found := store.Get(key, req.Header)
+		_, noCache := reqCacheControl["no-cache"]
+
+		if found && !noCache {
+			switch {
+			case entry.Fresh(now):
+				serveCacheEntry(c, entry, cacheHit, ifNoneMatch, ifModifiedSince)
+				recordCacheStatus(name, cacheHit)
+				c.Abort()
+				return
+			case entry.Stale(now):
+				serveCacheEntry(c, entry, cacheStale, ifNoneMatch, ifModifiedSince)
+				recordCacheStatus(name, cacheStale)
+				c.Abort()
+
+				if _, busy := revalidating.LoadOrStore(key, true); busy {
+					return
+				}
+
+				// The copy outlives the request, which may be cancelled as
+				// soon as the client has its response
+				bg := c.Copy()
+				bg.Request = req.Clone(context.WithoutCancel(req.Context()))
+				handler := c.Handler()
+				go func() {
+					defer revalidating.Delete(key)
+					defer func() {
+						if err := recover(); err != nil {
+							log.Printf("[CACHE] Revalidation of %s failed: %v", key, err)
+						}
+					}()
+
+					fetch(bg, func() { handler(bg) }, key, entry, true, "", "")
+				}()
+				return
+			}
+		}
+
+		if !found {
+			entry = nil
+		}
+		fetch(c, c.Next, key, entry, false, ifNoneMatch, ifModifiedSince)
+	}
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"cloud_gateway/cache"
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// closeNotifyRecorder adds the CloseNotify method httputil.ReverseProxy expects
+// from gin's response writer
+type closeNotifyRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r *closeNotifyRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func newCacheTestRouter(t *testing.T, cfg *config.CacheConfig, upstream http.HandlerFunc) *gin.Engine {
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewCacheMiddleware("test", cache.NewStore(1<<20, ""), cfg))
+	r.GET("/data", func(c *gin.Context) {
+		handlers.ProxyRequestHandler(c, server.URL, "/data")
+	})
+	return r
+}
+
+func cacheTestRequest(r *gin.Engine, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/data", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(&closeNotifyRecorder{w}, req)
+	return w
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	cfg := &config.CacheConfig{MaxSize: 1 << 20, MaxEntrySize: 1 << 10}
+
+	t.Run("serves fresh responses from cache", func(t *testing.T) {
+		calls := 0
+		r := newCacheTestRouter(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprintf(w, "response %d", calls)
+		})
+
+		first := cacheTestRequest(r, nil)
+		second := cacheTestRequest(r, nil)
+
+		if first.Header().Get("X-Cache") != cacheMiss || second.Header().Get("X-Cache") != cacheHit {
+			t.Errorf("Expected MISS then HIT, got %s then %s", first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+		}
+		if calls != 1 || second.Body.String() != "response 1" {
+			t.Errorf("Expected the cached response, got %q after %d upstream calls", second.Body.String(), calls)
+		}
+
+		notModified := cacheTestRequest(r, http.Header{"If-None-Match": {`"v1"`}})
+		if notModified.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for a matching If-None-Match, got %d", notModified.Code)
+		}
+	})
+
+	t.Run("revalidates expired responses", func(t *testing.T) {
+		var conditional string
+		r := newCacheTestRouter(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+			conditional = r.Header.Get("If-None-Match")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if conditional == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("payload"))
+		})
+
+		cacheTestRequest(r, nil)
+		w := cacheTestRequest(r, nil)
+
+		if conditional != `"v1"` {
+			t.Errorf("Expected the upstream to receive If-None-Match \"v1\", got %q", conditional)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != "payload" || w.Header().Get("X-Cache") != cacheRevalidated {
+			t.Errorf("Expected the revalidated entry, got %d %q (%s)", w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+		}
+	})
+
+	t.Run("serves stale responses while revalidating", func(t *testing.T) {
+		swrCfg := *cfg
+		swrCfg.TTL = time.Minute
+		swrCfg.StaleWhileRevalidate = time.Minute
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		store := cache.NewStore(1<<20, "")
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) > 1 {
+				<-release
+			}
+			fmt.Fprintf(w, "response %d", calls.Load())
+		}))
+		t.Cleanup(server.Close)
+
+		r := gin.New()
+		r.Use(NewCacheMiddleware("test", store, &swrCfg))
+		r.GET("/data", func(c *gin.Context) {
+			handlers.ProxyRequestHandler(c, server.URL, "/data")
+		})
+
+		cacheTestRequest(r, nil)
+		entry, _ := store.Get("example.com/data", nil)
+		expired := *entry
+		expired.Expires = time.Now().Add(-time.Second)
+		store.Set(&expired)
+
+		// The upstream blocks the revalidation until the stale response is in
+		stale := cacheTestRequest(r, nil)
+		if stale.Header().Get("X-Cache") != cacheStale || stale.Body.String() != "response 1" {
+			t.Errorf("Expected the stale response, got %q (%s)", stale.Body.String(), stale.Header().Get("X-Cache"))
+		}
+		close(release)
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			refreshed := cacheTestRequest(r, nil)
+			if refreshed.Header().Get("X-Cache") == cacheHit {
+				if refreshed.Body.String() != "response 2" || calls.Load() != 2 {
+					t.Errorf("Expected the entry refreshed in the background, got %q after %d upstream calls", refreshed.Body.String(), calls.Load())
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the entry to be refreshed in the background")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("does not store uncacheable responses", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			cacheControl string
+			reqHeader    http.Header
+			expected     string
+		}{
+			{name: "no-store response", cacheControl: "no-store", expected: cacheMiss},
+			{name: "private response", cacheControl: "private, max-age=60", expected: cacheMiss},
+			{name: "authorized request", cacheControl: "max-age=60", reqHeader: http.Header{"Authorization": {"Bearer token"}}, expected: cacheBypass},
+			{name: "request with cookie", cacheControl: "max-age=60", reqHeader: http.Header{"Cookie": {"session=abc"}}, expected: cacheBypass},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				r := newCacheTestRouter(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Cache-Control", tc.cacheControl)
+					w.Write([]byte("payload"))
+				})
+
+				cacheTestRequest(r, tc.reqHeader)
+				w := cacheTestRequest(r, tc.reqHeader)
+				if w.Header().Get("X-Cache") != tc.expected {
+					t.Errorf("Expected X-Cache %s, got %s", tc.expected, w.Header().Get("X-Cache"))
+				}
+			})
+		}
+	})
+
+	t.Run("keeps variants apart", func(t *testing.T) {
+		r := newCacheTestRouter(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+		})
+
+		cacheTestRequest(r, http.Header{"Accept-Language": {"en"}})
+		w := cacheTestRequest(r, http.Header{"Accept-Language": {"de"}})
+		if w.Header().Get("X-Cache") != cacheMiss || w.Body.String() != "de" {
+			t.Errorf("Expected a miss for another variant, got %q (%s)", w.Body.String(), w.Header().Get("X-Cache"))
+		}
+	})
+
+	t.Run("skips responses larger than max entry size", func(t *testing.T) {
+		r := newCacheTestRouter(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write(make([]byte, 2<<10))
+		})
+
+		cacheTestRequest(r, nil)
+		w := cacheTestRequest(r, nil)
+		if w.Header().Get("X-Cache") != cacheMiss || w.Body.Len() != 2<<10 {
+			t.Errorf("Expected the full response uncached, got %d bytes (%s)", w.Body.Len(), w.Header().Get("X-Cache"))
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"cloud_gateway/cache"
+	"cloud_gateway/config"
+	"cloud_gateway/metrics"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coalescedCall is an upstream call in flight. Once done is closed the
+// response is shared with the waiting requests, unless it could not be
+// buffered completely.
+type coalescedCall struct {
+	done   chan struct{}
+	shared bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// coalescingKey identifies identical requests by method, host, path, query
+// and the values of the configured headers
+func coalescingKey(req *http.Request, varyHeaders []string) string {
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.Host + req.URL.RequestURI())
+	for _, name := range varyHeaders {
+		key.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ","))
+	}
+	return key.String()
+}
+
+// personalized reports whether req carries credentials that are not part of
+// the coalescing key. Such requests may get a response meant for their client
+// only, so they are never coalesced.
+func personalized(req *http.Request, varyHeaders []string) bool {
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if req.Header.Get(name) == "" {
+			continue
+		}
+		if !slices.ContainsFunc(varyHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// shareable reports whether a response can be replayed to other clients: it
+// must not set cookies nor be restricted to the client that asked for it
+func shareable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) != 0 {
+		return false
+	}
+
+	directives := cache.ParseCacheControl(strings.Join(header.Values("Cache-Control"), ","))
+	_, private := directives["private"]
+	_, noStore := directives["no-store"]
+	return !private && !noStore
+}
+
+// NewCoalescingMiddleware collapses concurrent identical GET and HEAD requests
+// into a single upstream call. The first request proceeds as usual while its
+// response is recorded, the others wait and get a copy of it. Everything after
+// this middleware runs only for the first request, so middleware that depends
+// on the client, like authentication, has to come before it. Requests with
+// credentials are only coalesced when their headers are in 'vary_headers',
+// upgrade requests never are, and responses setting cookies or marked private
+// are never shared.
+func NewCoalescingMiddleware(name string, cfg *config.CoalescingConfig) gin.HandlerFunc {
+	var (
+		calls = make(map[string]*coalescedCall)
+		mu    sync.Mutex
+	)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		// An upgraded connection belongs to its client, it cannot be replayed
+		if c.Request.Header.Get("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		if personalized(c.Request, cfg.VaryHeaders) {
+			c.Next()
+			return
+		}
+
+		key := coalescingKey(c.Request, cfg.VaryHeaders)
+
+		mu.Lock()
+		call, inFlight := calls[key]
+		if !inFlight {
+			call = &coalescedCall{done: make(chan struct{})}
+			calls[key] = call
+		}
+		mu.Unlock()
+
+		if inFlight {
+			select {
+			case <-call.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+
+			// Too large or personal to be shared, the request makes its own
+			// upstream call
+			if !call.shared {
+				c.Next()
+				return
+			}
+
+			metrics.IncCounter("gateway_coalesced_requests_total", "coalescing", name)
+			header := c.Writer.Header()
+			for h, values := range call.header {
+				header[h] = append([]string(nil), values...)
+			}
+			c.Status(call.status)
+			c.Writer.WriteHeaderNow()
+			c.Writer.Write(call.body)
+			c.Abort()
+			return
+		}
+
+		writer := &captureWriter{
+			ResponseWriter: c.Writer,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+			maxSize:        cfg.MaxBodySize,
+			detached:       true,
+		}
+
+		// Waiters are released even if a handler panics
+		defer func() {
+			mu.Lock()
+			delete(calls, key)
+			mu.Unlock()
+			close(call.done)
+		}()
+
+		// The waiting requests depend on the upstream call, so it is not
+		// cancelled when the first client goes away
+		c.Request = c.Request.WithContext(context.WithoutCancel(c.Request.Context()))
+		c.Writer = writer
+		c.Next()
+		writer.WriteHeaderNow()
+		c.Writer = writer.ResponseWriter
+
+		if writer.tooLarge {
+			log.Printf("[MIDDLEWARE] response for %s exceeds the coalescing body limit, waiting requests are proxied", c.Request.URL)
+			return
+		}
+
+		if !shareable(writer.header) {
+			return
+		}
+
+		call.status = writer.status
+		call.header = writer.header
+		call.body = writer.body.Bytes()
+		call.shared = true
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCoalescingMiddleware(t *testing.T) {
+	testCases := []struct {
+		name           string
+		cfg            config.CoalescingConfig
+		accept         []string
+		authorization  []string
+		upgrade        string
+		responseHeader map[string]string
+		expectedCalls  int32
+	}{
+		{name: "identical requests", cfg: config.CoalescingConfig{MaxBodySize: 1 << 10}, accept: []string{"text/html", "application/json", "text/html"}, expectedCalls: 1},
+		{name: "different vary headers", cfg: config.CoalescingConfig{VaryHeaders: []string{"Accept"}, MaxBodySize: 1 << 10}, accept: []string{"text/html", "application/json", "text/html"}, expectedCalls: 2},
+		{name: "response too large", cfg: config.CoalescingConfig{MaxBodySize: 4}, accept: []string{"text/html", "text/html"}, expectedCalls: 2},
+		{
+			name:          "different bearer tokens",
+			cfg:           config.CoalescingConfig{MaxBodySize: 1 << 10},
+			accept:        []string{"text/html", "text/html"},
+			authorization: []string{"Bearer alice", "Bearer bob"},
+			expectedCalls: 2,
+		},
+		{
+			name:          "bearer tokens in vary headers",
+			cfg:           config.CoalescingConfig{VaryHeaders: []string{"authorization"}, MaxBodySize: 1 << 10},
+			accept:        []string{"text/html", "text/html", "text/html"},
+			authorization: []string{"Bearer alice", "Bearer bob", "Bearer alice"},
+			expectedCalls: 2,
+		},
+		{
+			name:          "upgrade requests",
+			cfg:           config.CoalescingConfig{MaxBodySize: 1 << 10},
+			accept:        []string{"text/html", "text/html"},
+			upgrade:       "websocket",
+			expectedCalls: 2,
+		},
+		{
+			name:           "response setting a cookie",
+			cfg:            config.CoalescingConfig{MaxBodySize: 1 << 10},
+			accept:         []string{"text/html", "text/html"},
+			responseHeader: map[string]string{"Set-Cookie": "session=abc"},
+			expectedCalls:  2,
+		},
+		{
+			name:           "private response",
+			cfg:            config.CoalescingConfig{MaxBodySize: 1 << 10},
+			accept:         []string{"text/html", "text/html"},
+			responseHeader: map[string]string{"Cache-Control": "private, max-age=60"},
+			expectedCalls:  2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			arrived := make(chan struct{}, 10)
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				arrived <- struct{}{}
+				<-release
+				w.Header().Set("X-Upstream", "yes")
+				w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+				for name, value := range tc.responseHeader {
+					w.Header().Set(name, value)
+				}
+				w.Write([]byte("payload"))
+			}))
+			defer server.Close()
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(NewCoalescingMiddleware("test", &tc.cfg))
+			r.GET("/data", func(c *gin.Context) {
+				handlers.ProxyRequestHandler(c, server.URL, "/data")
+			})
+
+			recorders := make([]*httptest.ResponseRecorder, len(tc.accept))
+			var wg sync.WaitGroup
+			for i, accept := range tc.accept {
+				recorders[i] = httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/data?page=1", nil)
+				req.Header.Set("Accept", accept)
+				if tc.authorization != nil {
+					req.Header.Set("Authorization", tc.authorization[i])
+				}
+				if tc.upgrade != "" {
+					req.Header.Set("Upgrade", tc.upgrade)
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.ServeHTTP(&closeNotifyRecorder{recorders[i]}, req)
+				}()
+
+				// The first request has to be in flight before the others arrive
+				if i == 0 {
+					<-arrived
+				}
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if actual := calls.Load(); actual != tc.expectedCalls {
+				t.Errorf("Expected %d upstream calls, got %d", tc.expectedCalls, actual)
+			}
+			for i, w := range recorders {
+				if w.Code != http.StatusOK || w.Body.String() != "payload" || w.Header().Get("X-Upstream") != "yes" {
+					t.Errorf("Request %d: expected the upstream response, got %d %q", i, w.Code, w.Body.String())
+				}
+				if tc.authorization != nil && w.Header().Get("X-Authorization") != tc.authorization[i] {
+					t.Errorf("Request %d: expected the response for %q, got the one for %q", i, tc.authorization[i], w.Header().Get("X-Authorization"))
+				}
+			}
+		})
+	}
+}
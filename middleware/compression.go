@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"bytes"
+	"cloud_gateway/config"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Encoders are pooled as their state is expensive to allocate per response
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriter(nil)
+	}},
+	"zstd": {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+// negotiateEncoding picks the encoding with the highest quality in the
+// Accept-Encoding header, ties are broken by the order of the supported ones
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[strings.ToLower(strings.TrimSpace(coding))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// contentTypeMatcher matches media types against patterns with an optional
+// wildcard, e.g. "text/*" or "application/*+json"
+type contentTypeMatcher [][2]string
+
+func newContentTypeMatcher(contentTypes []string) contentTypeMatcher {
+	var m contentTypeMatcher
+	for _, contentType := range contentTypes {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		prefix, suffix, _ := strings.Cut(mediaType, "*")
+		m = append(m, [2]string{prefix, suffix})
+	}
+	return m
+}
+
+func (m contentTypeMatcher) matches(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range m {
+		prefix, suffix := pattern[0], pattern[1]
+		if suffix == "" && !strings.HasSuffix(prefix, "/") {
+			if mediaType == prefix {
+				return true
+			}
+		} else if len(mediaType) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(mediaType, prefix) && strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides whether to compress once the response headers are
+// known. Responses without a Content-Length are buffered until they reach the
+// minimum size, are flushed or end.
+type compressWriter struct {
+	gin.ResponseWriter
+	cfg          *config.CompressionConfig
+	contentTypes contentTypeMatcher
+	encoding     string
+	head         bool
+
+	decided bool
+	enc     encoder
+	buf     bytes.Buffer
+}
+
+// eligible reports whether the response may be compressed at all, depending
+// on the client accepting an encoding or not
+func (w *compressWriter) eligible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+
+	// Event streams are flushed per event, compressing them only adds latency
+	contentType := header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	return w.contentTypes.matches(contentType)
+}
+
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+
+	if compress {
+		header := w.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		// The compressed representation differs byte for byte
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.enc = encoderPools[w.encoding].Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	if w.buf.Len() != 0 {
+		w.write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// start makes the decisions that only depend on the headers, it returns true
+// when the body has to be buffered to know its size
+func (w *compressWriter) start() bool {
+	if w.decided {
+		return false
+	}
+
+	if !w.eligible() {
+		w.decide(false)
+		return false
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if w.encoding == "" || w.head {
+		w.decide(false)
+		return false
+	}
+
+	if contentLength := w.Header().Get("Content-Length"); contentLength != "" {
+		size, err := strconv.Atoi(contentLength)
+		w.decide(err == nil && size >= w.cfg.MinSize)
+		return false
+	}
+	return true
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if buffer := w.start(); buffer {
+			w.buf.Write(data)
+			if w.buf.Len() >= w.cfg.MinSize {
+				w.decide(true)
+			}
+			return len(data), nil
+		}
+	}
+	return w.write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	// Headers are only sent once it is known if the body is compressed
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush sends what was written so far, streamed responses of unknown size are
+// compressed right away instead of waiting for the minimum size
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if buffer := w.start(); buffer {
+			w.decide(true)
+		}
+	}
+
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close sends the rest of the response once the handlers returned
+func (w *compressWriter) close() {
+	if !w.decided {
+		// Bodies smaller than the minimum size are sent as they are
+		if buffer := w.start(); buffer {
+			w.decide(false)
+		}
+		w.ResponseWriter.WriteHeaderNow()
+	}
+
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(nil)
+		encoderPools[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// NewCompressionMiddleware compresses responses with the best encoding the
+// client accepts. Only the configured content types are compressed, and only
+// when they are at least the minimum size. Responses that are already encoded
+// or streamed as server sent events are sent unchanged.
+func NewCompressionMiddleware(cfg *config.CompressionConfig) gin.HandlerFunc {
+	contentTypes := newContentTypeMatcher(cfg.ContentTypes)
+
+	return func(c *gin.Context) {
+		if c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: c.Writer,
+			cfg:            cfg,
+			contentTypes:   contentTypes,
+			encoding:       negotiateEncoding(c.GetHeader("Accept-Encoding"), cfg.Encodings),
+			head:           c.Request.Method == http.MethodHead,
+		}
+		c.Writer = writer
+		c.Next()
+		writer.close()
+		c.Writer = writer.ResponseWriter
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("Invalid gzip body: %v", err)
+		}
+		r = gz
+	case "br":
+		r = brotli.NewReader(body)
+	case "zstd":
+		dec, err := zstd.NewReader(body)
+		if err != nil {
+			t.Fatalf("Invalid zstd body: %v", err)
+		}
+		defer dec.Close()
+		r = dec
+	default:
+		r = body
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s body: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"zstd", "br", "gzip"}
+
+	testCases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "gzip, deflate, br, zstd", expected: "zstd"},
+		{acceptEncoding: "gzip;q=1.0, br;q=0.8", expected: "gzip"},
+		{acceptEncoding: "br;q=0, gzip;q=0.5", expected: "gzip"},
+		{acceptEncoding: "*", expected: "zstd"},
+		{acceptEncoding: "identity", expected: ""},
+		{acceptEncoding: "", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		if actual := negotiateEncoding(tc.acceptEncoding, supported); actual != tc.expected {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", tc.acceptEncoding, tc.expected, actual)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	payload := `{"items":"` + strings.Repeat("a", 2048) + `"}`
+
+	testCases := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		contentEncoding  string
+		body             string
+		chunked          bool
+		expectedEncoding string
+		expectVary       bool
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: "application/json", body: payload, expectedEncoding: "gzip", expectVary: true},
+		{name: "brotli", acceptEncoding: "br", contentType: "application/json", body: payload, expectedEncoding: "br", expectVary: true},
+		{name: "zstd", acceptEncoding: "gzip, br, zstd", contentType: "application/json", body: payload, expectedEncoding: "zstd", expectVary: true},
+		{name: "streamed without content length", acceptEncoding: "gzip", contentType: "text/plain", body: payload, chunked: true, expectedEncoding: "gzip", expectVary: true},
+		{name: "not accepted", acceptEncoding: "", contentType: "application/json", body: payload, expectVary: true},
+		{name: "below min size", acceptEncoding: "gzip", contentType: "application/json", body: `{"ok":true}`, expectVary: true},
+		{name: "stream flushed below min size", acceptEncoding: "gzip", contentType: "application/json", body: `{"ok":true}`, chunked: true, expectedEncoding: "gzip", expectVary: true},
+		{name: "ineligible content type", acceptEncoding: "gzip", contentType: "image/png", body: payload},
+		{name: "already encoded", acceptEncoding: "gzip", contentType: "application/json", contentEncoding: "identity", body: payload},
+		{name: "event stream", acceptEncoding: "gzip", contentType: "text/event-stream", body: payload},
+	}
+
+	cfg := &config.CompressionConfig{}
+	cfg.Encodings = []string{"zstd", "br", "gzip"}
+	cfg.MinSize = 1024
+	cfg.ContentTypes = []string{"text/*", "application/json"}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				if tc.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tc.contentEncoding)
+				}
+				if !tc.chunked {
+					w.Write([]byte(tc.body))
+					return
+				}
+				// Flushing before the end makes the response chunked
+				for _, part := range []string{tc.body[:len(tc.body)/2], tc.body[len(tc.body)/2:]} {
+					w.Write([]byte(part))
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer server.Close()
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(NewCompressionMiddleware(cfg))
+			r.GET("/data", func(c *gin.Context) {
+				handlers.ProxyRequestHandler(c, server.URL, "/data")
+			})
+
+			req := httptest.NewRequest("GET", "/data", nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(&closeNotifyRecorder{w}, req)
+
+			encoding := w.Header().Get("Content-Encoding")
+			if tc.contentEncoding == "" && encoding != tc.expectedEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tc.expectedEncoding, encoding)
+			}
+			if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != tc.expectVary {
+				t.Errorf("Expected Vary: Accept-Encoding %v, got %v", tc.expectVary, vary)
+			}
+			if tc.expectedEncoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Error("Content-Length of the uncompressed body should have been removed")
+			}
+			if body := decompress(t, tc.expectedEncoding, w.Body); body != tc.body {
+				t.Errorf("Expected the original body, got %d bytes", len(body))
+			}
+		})
+	}
+}
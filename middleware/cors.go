@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/grpc"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type originMatcher struct {
+	any       bool
+	exact     map[string]bool
+	wildcards [][2]string
+	patterns  []*regexp.Regexp
+}
+
+func newOriginMatcher(cfg *config.CORSConfig) *originMatcher {
+	m := &originMatcher{exact: make(map[string]bool)}
+
+	for _, origin := range cfg.AllowOrigins {
+		switch {
+		case origin == "*":
+			m.any = true
+		case strings.Contains(origin, "*"):
+			// "https://*.example.com" is kept as its parts around the wildcard
+			prefix, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			m.wildcards = append(m.wildcards, [2]string{prefix, suffix})
+		default:
+			m.exact[strings.ToLower(origin)] = true
+		}
+	}
+
+	for _, pattern := range cfg.AllowOriginPatterns {
+		m.patterns = append(m.patterns, regexp.MustCompile(pattern))
+	}
+
+	return m
+}
+
+func (m *originMatcher) matches(origin string) bool {
+	if m.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if m.exact[origin] {
+		return true
+	}
+
+	for _, wildcard := range m.wildcards {
+		prefix, suffix := wildcard[0], wildcard[1]
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewCORSMiddleware answers preflight requests on behalf of the upstream and
+// decorates actual cross origin responses. CORS headers set by the upstream
+// are replaced, so browsers never see conflicting values.
+func NewCORSMiddleware(cfg *config.CORSConfig) gin.HandlerFunc {
+	origins := newOriginMatcher(cfg)
+	allowMethods := strings.Join(cfg.AllowMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	// gRPC-Web clients need their request headers allowed and the status of
+	// trailers-only responses exposed, on top of the configured headers
+	webAllowHeaders := strings.Join(appendMissing(cfg.AllowHeaders, grpc.WebHeaders), ", ")
+	webExposeHeaders := strings.Join(appendMissing(cfg.ExposeHeaders, grpc.WebExposeHeaders), ", ")
+
+	// When any origin is allowed without credentials the response does not
+	// depend on the request origin
+	allowOrigin := func(origin string) string {
+		if origins.any && !cfg.AllowCredentials {
+			return "*"
+		}
+		return origin
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		allowed := origins.matches(origin)
+		isPreflight := c.Request.Method == http.MethodOptions &&
+			c.GetHeader("Access-Control-Request-Method") != ""
+
+		if isPreflight {
+			c.Writer.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+			if !allowed {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Header("Access-Control-Allow-Origin", allowOrigin(origin))
+			c.Header("Access-Control-Allow-Methods", allowMethods)
+			requested := c.GetHeader("Access-Control-Request-Headers")
+			if allowHeaders != "" && strings.Contains(strings.ToLower(requested), "x-grpc-web") {
+				c.Header("Access-Control-Allow-Headers", webAllowHeaders)
+			} else if allowHeaders != "" {
+				c.Header("Access-Control-Allow-Headers", allowHeaders)
+			} else if requested != "" {
+				// Without a configured list every requested header is allowed
+				c.Header("Access-Control-Allow-Headers", requested)
+			}
+			if cfg.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		// The call is translated to native gRPC before the response is sent
+		isGRPCWeb := grpc.IsGRPCWeb(c.Request)
+		withHeaderHook(c, func(status int, header http.Header) {
+			for key := range header {
+				if strings.HasPrefix(key, "Access-Control-") {
+					header.Del(key)
+				}
+			}
+
+			header.Add("Vary", "Origin")
+			if !allowed {
+				return
+			}
+
+			header.Set("Access-Control-Allow-Origin", allowOrigin(origin))
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if isGRPCWeb {
+				header.Set("Access-Control-Expose-Headers", webExposeHeaders)
+			} else if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+		})
+
+		c.Next()
+	}
+}
+
+// appendMissing returns headers with the ones of extra it does not contain yet
+func appendMissing(headers, extra []string) []string {
+	result := append([]string{}, headers...)
+	for _, e := range extra {
+		found := false
+		for _, h := range headers {
+			if strings.EqualFold(h, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(cfg *config.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	handler := func(c *gin.Context) {
+		// Simulates an upstream with its own CORS handling
+		c.Header("Access-Control-Allow-Origin", "https://upstream.com")
+		c.Header("X-Request-Id", "abc")
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	}
+	r.GET("/api", NewCORSMiddleware(cfg), handler)
+	r.OPTIONS("/api", NewCORSMiddleware(cfg), handler)
+
+	return r
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	cfg := config.CORSConfig{
+		AllowOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginPatterns: []string{`^https://pr-[0-9]+\.preview\.dev$`},
+		AllowMethods:        []string{"GET", "POST"},
+		AllowCredentials:    true,
+		MaxAge:              10 * time.Minute,
+	}
+	r := newCORSRouter(&cfg)
+
+	testCases := []struct {
+		name     string
+		origin   string
+		expected int
+	}{
+		{name: "exact origin", origin: "https://app.example.com", expected: http.StatusNoContent},
+		{name: "wildcard subdomain", origin: "https://a.b.example.org", expected: http.StatusNoContent},
+		{name: "wildcard does not match apex", origin: "https://example.org", expected: http.StatusForbidden},
+		{name: "regex origin", origin: "https://pr-42.preview.dev", expected: http.StatusNoContent},
+		{name: "unknown origin", origin: "https://evil.com", expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "Content-Type, Authorization")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.expected {
+				t.Fatalf("Expected status code: %v, got %v", tc.expected, w.Code)
+			}
+
+			if tc.expected != http.StatusNoContent {
+				if w.Header().Get("Access-Control-Allow-Origin") != "" {
+					t.Error("Access-Control-Allow-Origin should not be set for a rejected origin")
+				}
+				return
+			}
+
+			expectedHeaders := map[string]string{
+				"Access-Control-Allow-Origin":      tc.origin,
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			}
+			for header, expected := range expectedHeaders {
+				if actual := w.Header().Get(header); actual != expected {
+					t.Errorf("Expected %s: %q, got %q", header, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareActualRequest(t *testing.T) {
+	cfg := config.CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{"GET"},
+		ExposeHeaders: []string{"X-Request-Id"},
+	}
+	r := newCORSRouter(&cfg)
+
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("Origin", "https://anything.com")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+	}
+
+	if values := w.Header().Values("Access-Control-Allow-Origin"); len(values) != 1 || values[0] != "*" {
+		t.Errorf("Expected upstream Access-Control-Allow-Origin to be replaced by '*', got %v", values)
+	}
+
+	if actual := w.Header().Get("Access-Control-Expose-Headers"); actual != "X-Request-Id" {
+		t.Errorf("Expected Access-Control-Expose-Headers: %s, got %s", "X-Request-Id", actual)
+	}
+
+	if actual := w.Header().Get("Vary"); actual != "Origin" {
+		t.Errorf("Expected Vary: %s, got %s", "Origin", actual)
+	}
+
+	// Requests without an Origin are not cross origin and are left untouched
+	req = httptest.NewRequest("GET", "/api", nil)
+	w = httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if actual := w.Header().Get("Access-Control-Allow-Origin"); actual != "https://upstream.com" {
+		t.Errorf("Expected upstream Access-Control-Allow-Origin to be kept, got %s", actual)
+	}
+}
+
+// The response headers are decorated right before they are sent, whenever the
+// handler sets them and however the response is completed
+func TestCORSMiddlewareHeaderTiming(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "https://upstream.com")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	testCases := []struct {
+		name           string
+		method         string
+		handler        gin.HandlerFunc
+		expectedStatus int
+	}{
+		{
+			name:   "headers set after the status",
+			method: "GET",
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusOK)
+				c.Header("Access-Control-Allow-Origin", "https://upstream.com")
+				c.String(http.StatusOK, "OK")
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "proxied response without body",
+			method: "GET",
+			handler: func(c *gin.Context) {
+				handlers.ProxyRequestHandler(c, backend.URL, "/api")
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			// Redirects of methods other than GET and HEAD have no body
+			name:   "redirect",
+			method: "POST",
+			handler: func(c *gin.Context) {
+				handlers.RedirectHandler(c, "https://example.com/api", http.StatusFound)
+			},
+			expectedStatus: http.StatusFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Handle(tc.method, "/api", NewCORSMiddleware(&config.CORSConfig{AllowOrigins: []string{"*"}}), tc.handler)
+
+			req := httptest.NewRequest(tc.method, "/api", nil)
+			req.Header.Set("Origin", "https://anything.com")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(&closeNotifyRecorder{w}, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("Expected status code: %v, got %v", tc.expectedStatus, w.Code)
+			}
+
+			if values := w.Header().Values("Access-Control-Allow-Origin"); len(values) != 1 || values[0] != "*" {
+				t.Errorf("Expected Access-Control-Allow-Origin to be '*', got %v", values)
+			}
+		})
+	}
+}
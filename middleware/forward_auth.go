@@ -3,6 +3,8 @@ package middleware
 import (
 	"bytes"
 	"cloud_gateway/config"
+	"cloud_gateway/grpc"
+	"cloud_gateway/metrics"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -15,7 +17,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func NewForwardAuthMiddleware(cfg *config.ForwardAuthConfig) gin.HandlerFunc {
+func NewForwardAuthMiddleware(name string, cfg *config.ForwardAuthConfig) gin.HandlerFunc {
 
 	var client *http.Client
 	if cfg.CertFilepath != "" {
@@ -39,7 +41,12 @@ func NewForwardAuthMiddleware(cfg *config.ForwardAuthConfig) gin.HandlerFunc {
 		// Prepare body
 		var body io.Reader
 		if cfg.ForwardBody {
-			bodyBytes, err := io.ReadAll(c.Request.Body)
+			// One byte more than allowed tells a body of exactly the limit from a larger one
+			bodyBytes, err := io.ReadAll(io.LimitReader(c.Request.Body, cfg.MaxBodySize+1))
+			if isBodyTooLarge(err) || int64(len(bodyBytes)) > cfg.MaxBodySize {
+				abortBodyTooLarge(c)
+				return
+			}
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to read request body"})
 				return
@@ -88,6 +95,16 @@ func NewForwardAuthMiddleware(cfg *config.ForwardAuthConfig) gin.HandlerFunc {
 		// Send the request
 		resp, err := client.Do(authReq)
 		if err != nil {
+			metrics.IncCounter("gateway_forward_auth_rejections_total", "auth", name, "mode", cfg.Mode)
+			if cfg.Mode == config.ModeDryRun {
+				log.Printf("[FORWARD AUTH] [DRY RUN] '%s' auth service unreachable: %v", name, err)
+				c.Next()
+				return
+			}
+			if grpc.IsCall(c.Request) {
+				grpc.Abort(c, http.StatusServiceUnavailable, "auth service unreachable")
+				return
+			}
 			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("auth service unreachable: %v", err)})
 			return
 		}
@@ -95,6 +112,15 @@ func NewForwardAuthMiddleware(cfg *config.ForwardAuthConfig) gin.HandlerFunc {
 
 		// If not authorized, return the response as-is
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			metrics.IncCounter("gateway_forward_auth_rejections_total", "auth", name, "mode", cfg.Mode)
+
+			// In dry run mode nothing from the auth response reaches the client
+			if cfg.Mode == config.ModeDryRun {
+				log.Printf("[FORWARD AUTH] [DRY RUN] '%s' rejected request with status %d", name, resp.StatusCode)
+				c.Next()
+				return
+			}
+
 			// Propagate headers
 			for _, h := range cfg.ResponseHeaders {
 				if val := resp.Header.Get(h); val != "" {
@@ -111,6 +137,12 @@ func NewForwardAuthMiddleware(cfg *config.ForwardAuthConfig) gin.HandlerFunc {
 				}
 			}
 
+			// gRPC clients cannot read the body of the auth service
+			if grpc.IsCall(c.Request) {
+				grpc.Abort(c, resp.StatusCode, http.StatusText(resp.StatusCode))
+				return
+			}
+
 			c.Status(resp.StatusCode)
 			io.Copy(c.Writer, resp.Body)
 			c.Abort()
@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"cloud_gateway/config"
+	"cloud_gateway/metrics"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -70,6 +71,7 @@ func TestForwardAuthMiddlewareAuthorized(t *testing.T) {
 		Timeout:              2 * time.Second,
 		Method:               method,
 		ForwardBody:          true,
+		MaxBodySize:          1 << 10,
 		TrustForwardHeader:   true,
 		RequestHeaders:       []string{"Authorization", "Mock-Header"},
 		ResponseHeaders:      []string{"X-Test-Header"},
@@ -80,7 +82,7 @@ func TestForwardAuthMiddlewareAuthorized(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	r.Use(NewForwardAuthMiddleware(&cfg))
+	r.Use(NewForwardAuthMiddleware("auth", &cfg))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "OK"})
 	})
@@ -185,7 +187,7 @@ func TestForwardAuthMiddlewareUnauthorized(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	r.Use(NewForwardAuthMiddleware(&cfg))
+	r.Use(NewForwardAuthMiddleware("auth", &cfg))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "OK"})
 	})
@@ -222,6 +224,72 @@ func TestForwardAuthMiddlewareUnauthorized(t *testing.T) {
 	}
 }
 
+func TestForwardAuthMiddlewareGRPCRejection(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"forbidden"}`))
+	}))
+	defer authServer.Close()
+
+	cfg := config.ForwardAuthConfig{Url: authServer.URL, Timeout: 2 * time.Second, Method: "GET"}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewForwardAuthMiddleware("auth", &cfg))
+	r.POST("/pkg.Service/Method", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/pkg.Service/Method", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != "7" {
+		t.Errorf("Expected a permission denied gRPC status, got %d with grpc-status %q", w.Code, w.Header().Get("Grpc-Status"))
+	}
+	if w.Header().Get("Content-Type") != "application/grpc" || w.Body.Len() != 0 {
+		t.Errorf("Expected a trailers-only gRPC response, got %q with body %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestForwardAuthMiddlewareBodyTooLarge(t *testing.T) {
+	authCalled := false
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	cfg := config.ForwardAuthConfig{
+		Url:         authServer.URL,
+		Timeout:     2 * time.Second,
+		Method:      "POST",
+		ForwardBody: true,
+		MaxBodySize: 16,
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.Use(NewForwardAuthMiddleware("auth", &cfg))
+	r.POST("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	req := httptest.NewRequest("POST", "/protected", strings.NewReader(strings.Repeat("a", 17)))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code: %v, got %v", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if authCalled {
+		t.Error("Auth service should not have been called")
+	}
+}
+
 func TestForwardAuthMiddlewareTimeout(t *testing.T) {
 	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(3 * time.Second)
@@ -241,7 +309,7 @@ func TestForwardAuthMiddlewareTimeout(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	r.Use(NewForwardAuthMiddleware(&cfg))
+	r.Use(NewForwardAuthMiddleware("auth", &cfg))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "OK"})
 	})
@@ -259,3 +327,50 @@ func TestForwardAuthMiddlewareTimeout(t *testing.T) {
 		t.Errorf("Expected auth service to be unreachable")
 	}
 }
+
+func TestForwardAuthMiddlewareDryRun(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test-Header", "test_header")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"unauthorized"}`))
+	}))
+	defer authServer.Close()
+
+	cfg := config.ForwardAuthConfig{
+		Url:             authServer.URL,
+		Timeout:         2 * time.Second,
+		Method:          "GET",
+		ResponseHeaders: []string{"X-Test-Header"},
+		Mode:            config.ModeDryRun,
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.Use(NewForwardAuthMiddleware("dry_run_auth", &cfg))
+	r.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+	}
+
+	if w.Body.String() != `{"message":"OK"}` {
+		t.Errorf("Expected body string: %s, got %s", `{"message":"OK"}`, w.Body.String())
+	}
+
+	if w.Header().Get("X-Test-Header") != "" {
+		t.Error("X-Test-Header should not have been forwarded in dry run mode")
+	}
+
+	rejections := metrics.Value("gateway_forward_auth_rejections_total", "auth", "dry_run_auth", "mode", config.ModeDryRun)
+	if rejections != 1 {
+		t.Errorf("Expected %d dry run rejections, got %d", 1, rejections)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint `maxminddb:"autonomous_system_number"`
+}
+
+var (
+	geoIPReaders   = make(map[string]*maxminddb.Reader)
+	geoIPReadersMu sync.Mutex
+)
+
+// openGeoIPDatabase opens a MaxMind database once and shares the reader
+// between all geoip middleware referencing the same file
+func openGeoIPDatabase(filepath string) *maxminddb.Reader {
+	geoIPReadersMu.Lock()
+	defer geoIPReadersMu.Unlock()
+
+	if reader, ok := geoIPReaders[filepath]; ok {
+		return reader
+	}
+
+	reader, err := maxminddb.Open(filepath)
+	if err != nil {
+		log.Fatalf("[GEOIP] Failed to open database %s: %v", filepath, err)
+	}
+	geoIPReaders[filepath] = reader
+
+	return reader
+}
+
+// NewGeoIPMiddleware allows or denies clients by the country and autonomous
+// system their ip belongs to. Clients that are not found in a database match
+// no deny rule and no allow rule, so they are rejected only when an allow list
+// is defined.
+func NewGeoIPMiddleware(cfg *config.GeoIPConfig) gin.HandlerFunc {
+	var countryDB, asnDB *maxminddb.Reader
+	if cfg.CountryDatabase != "" {
+		countryDB = openGeoIPDatabase(cfg.CountryDatabase)
+	}
+	if cfg.ASNDatabase != "" {
+		asnDB = openGeoIPDatabase(cfg.ASNDatabase)
+	}
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		ip := net.ParseIP(clientIP)
+
+		var country string
+		var asn uint
+		if ip != nil && countryDB != nil {
+			var record geoIPRecord
+			if err := countryDB.Lookup(ip, &record); err != nil {
+				log.Printf("[GEOIP] Country lookup failed for %s: %v", clientIP, err)
+			}
+			country = record.Country.ISOCode
+		}
+		if ip != nil && asnDB != nil {
+			var record geoIPRecord
+			if err := asnDB.Lookup(ip, &record); err != nil {
+				log.Printf("[GEOIP] ASN lookup failed for %s: %v", clientIP, err)
+			}
+			asn = record.ASN
+		}
+
+		countryDenied := slices.Contains(cfg.DenyCountries, country) ||
+			(len(cfg.AllowCountries) != 0 && !slices.Contains(cfg.AllowCountries, country))
+		asnDenied := slices.Contains(cfg.DenyASNs, asn) ||
+			(len(cfg.AllowASNs) != 0 && !slices.Contains(cfg.AllowASNs, asn))
+
+		if countryDenied || asnDenied {
+			log.Printf("[GEOIP] Rejected request from client %s (country '%s', asn %d)", clientIP, country, asn)
+			abortWithBody(c, cfg.RejectStatus, cfg.RejectBody)
+			return
+		}
+
+		if cfg.AddHeaders {
+			// Never trust values sent by the client itself
+			c.Request.Header.Del("X-Client-Country")
+			c.Request.Header.Del("X-Client-ASN")
+
+			if country != "" {
+				c.Request.Header.Set("X-Client-Country", country)
+			}
+			if asn != 0 {
+				c.Request.Header.Set("X-Client-ASN", strconv.FormatUint(uint64(asn), 10))
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeTestGeoIPDatabase generates a small database in the layout of the
+// MaxMind country and ASN databases
+func writeTestGeoIPDatabase(t *testing.T, records map[string]mmdbtype.Map) string {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "Test-GeoIP", RecordSize: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Insert(network, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbFilepath := filepath.Join(t.TempDir(), "test.mmdb")
+	file, err := os.Create(dbFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := tree.WriteTo(file); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbFilepath
+}
+
+func TestGeoIPMiddleware(t *testing.T) {
+	countryDB := writeTestGeoIPDatabase(t, map[string]mmdbtype.Map{
+		"81.2.69.0/24":     {"country": mmdbtype.Map{"iso_code": mmdbtype.String("GB")}},
+		"89.160.20.0/24":   {"country": mmdbtype.Map{"iso_code": mmdbtype.String("SE")}},
+		"2001:218::/32":    {"country": mmdbtype.Map{"iso_code": mmdbtype.String("JP")}},
+		"175.16.199.0/24":  {"country": mmdbtype.Map{"iso_code": mmdbtype.String("CN")}},
+		"216.160.83.56/29": {"country": mmdbtype.Map{"iso_code": mmdbtype.String("US")}},
+	})
+	asnDB := writeTestGeoIPDatabase(t, map[string]mmdbtype.Map{
+		"81.2.69.0/24":   {"autonomous_system_number": mmdbtype.Uint32(20712)},
+		"89.160.20.0/24": {"autonomous_system_number": mmdbtype.Uint32(29518)},
+	})
+
+	cfg := config.GeoIPConfig{
+		CountryDatabase: countryDB,
+		ASNDatabase:     asnDB,
+		AllowCountries:  []string{"GB", "SE", "JP"},
+		DenyASNs:        []uint{29518},
+		AddHeaders:      true,
+		RejectStatus:    http.StatusForbidden,
+		RejectBody:      `{"error":"access denied"}`,
+	}
+
+	var received http.Header
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+
+	r.Use(NewGeoIPMiddleware(&cfg))
+	r.GET("/restricted", func(c *gin.Context) {
+		received = c.Request.Header.Clone()
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	testCases := []struct {
+		name            string
+		remoteAddr      string
+		expected        int
+		expectedCountry string
+		expectedASN     string
+	}{
+		{name: "allowed country", remoteAddr: "81.2.69.142:1234", expected: http.StatusOK, expectedCountry: "GB", expectedASN: "20712"},
+		{name: "allowed ipv6 country without asn", remoteAddr: "[2001:218::1]:1234", expected: http.StatusOK, expectedCountry: "JP"},
+		{name: "denied asn in allowed country", remoteAddr: "89.160.20.112:1234", expected: http.StatusForbidden},
+		{name: "country not in allow list", remoteAddr: "175.16.199.1:1234", expected: http.StatusForbidden},
+		{name: "unknown country", remoteAddr: "1.1.1.1:1234", expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+			req := httptest.NewRequest("GET", "/restricted", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Client-Country", "spoofed")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.expected {
+				t.Fatalf("Expected status code: %v, got %v", tc.expected, w.Code)
+			}
+
+			if tc.expected != http.StatusOK {
+				return
+			}
+
+			if actual := received.Get("X-Client-Country"); actual != tc.expectedCountry {
+				t.Errorf("Expected X-Client-Country: %s, got %s", tc.expectedCountry, actual)
+			}
+			if actual := received.Get("X-Client-ASN"); actual != tc.expectedASN {
+				t.Errorf("Expected X-Client-ASN: %s, got %s", tc.expectedASN, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"crypto/rand"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDKey = "request_id"
+
+// RequestID returns the id of the request, taken from the X-Request-Id header
+// when the client or a proxy in front of the gateway already set one. A new id
+// is generated otherwise and stored in the request headers, so that it is
+// forwarded upstream as well.
+func RequestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+
+	id := c.GetHeader("X-Request-Id")
+	if id == "" {
+		id = rand.Text()
+		c.Request.Header.Set("X-Request-Id", id)
+	}
+
+	c.Set(requestIDKey, id)
+	return id
+}
+
+// renderTemplate replaces the template variables of a header value
+func renderTemplate(c *gin.Context, value string) string {
+	if !strings.Contains(value, "{") {
+		return value
+	}
+
+	return config.TemplateVariable.ReplaceAllStringFunc(value, func(match string) string {
+		switch variable := match[1 : len(match)-1]; variable {
+		case "client_ip":
+			return c.ClientIP()
+		case "host":
+			return c.Request.Host
+		case "method":
+			return c.Request.Method
+		case "path":
+			return c.Request.URL.Path
+		case "request_id":
+			return RequestID(c)
+		default:
+			return c.Param(strings.TrimPrefix(variable, "param."))
+		}
+	})
+}
+
+// applyHeaderRules applies the rules in a fixed order: rename, remove, set
+// and finally append
+func applyHeaderRules(c *gin.Context, header http.Header, rules *config.HeaderRulesConfig) {
+	for from, to := range rules.Rename {
+		if values := header.Values(from); len(values) != 0 {
+			header.Del(from)
+			for _, v := range values {
+				header.Add(to, v)
+			}
+		}
+	}
+
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+
+	for name, value := range rules.Set {
+		header.Set(name, renderTemplate(c, value))
+	}
+
+	for name, value := range rules.Append {
+		header.Add(name, renderTemplate(c, value))
+	}
+}
+
+// NewHeadersMiddleware rewrites the request headers before the request is
+// proxied and the response headers right before they are sent to the client
+func NewHeadersMiddleware(cfg *config.HeadersConfig) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		applyHeaderRules(c, c.Request.Header, &cfg.Request)
+
+		withHeaderHook(c, func(status int, header http.Header) {
+			applyHeaderRules(c, header, &cfg.Response)
+		})
+
+		c.Next()
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bufio"
+	"cloud_gateway/config"
+	"cloud_gateway/handlers"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHeadersMiddleware(t *testing.T) {
+	cfg := config.HeadersConfig{
+		Request: config.HeaderRulesConfig{
+			Set: map[string]string{
+				"X-Real-Ip":  "{client_ip}",
+				"X-User-Id":  "user-{param.id}",
+				"X-Trace-Id": "{request_id}",
+			},
+			Append: map[string]string{"X-Forwarded-Host": "{host}"},
+			Remove: []string{"Cookie"},
+			Rename: map[string]string{"X-Legacy-Token": "Authorization"},
+		},
+		Response: config.HeaderRulesConfig{
+			Set:    map[string]string{"X-Request-Id": "{request_id}"},
+			Remove: []string{"Server"},
+			Rename: map[string]string{"X-Upstream-Version": "X-Version"},
+		},
+	}
+
+	var received http.Header
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+
+	r.Use(NewHeadersMiddleware(&cfg))
+	r.GET("/users/:id", func(c *gin.Context) {
+		received = c.Request.Header.Clone()
+		c.Header("Server", "upstream/1.0")
+		c.Header("X-Upstream-Version", "2")
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Host = "api.example.com"
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("X-Legacy-Token", "Bearer abc")
+	req.Header.Set("X-Forwarded-Host", "edge.example.com")
+	req.Header.Set("X-Request-Id", "req-123")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	expectedRequestHeaders := map[string]string{
+		"X-Real-Ip":      "192.0.2.1",
+		"X-User-Id":      "user-42",
+		"X-Trace-Id":     "req-123",
+		"Cookie":         "",
+		"Authorization":  "Bearer abc",
+		"X-Legacy-Token": "",
+	}
+	for header, expected := range expectedRequestHeaders {
+		if actual := received.Get(header); actual != expected {
+			t.Errorf("Expected request %s: %q, got %q", header, expected, actual)
+		}
+	}
+
+	if values := received.Values("X-Forwarded-Host"); len(values) != 2 || values[1] != "api.example.com" {
+		t.Errorf("Expected X-Forwarded-Host to be appended, got %v", values)
+	}
+
+	expectedResponseHeaders := map[string]string{
+		"X-Request-Id":       "req-123",
+		"Server":             "",
+		"X-Version":          "2",
+		"X-Upstream-Version": "",
+	}
+	for header, expected := range expectedResponseHeaders {
+		if actual := w.Header().Get(header); actual != expected {
+			t.Errorf("Expected response %s: %q, got %q", header, expected, actual)
+		}
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	cfg := config.HeadersConfig{
+		Response: config.HeaderRulesConfig{
+			Set: map[string]string{"X-Request-Id": "{request_id}"},
+		},
+	}
+
+	var received string
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.Use(NewHeadersMiddleware(&cfg))
+	r.GET("/", func(c *gin.Context) {
+		received = c.Request.Header.Get("X-Request-Id")
+		c.String(http.StatusOK, "OK")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	actual := w.Header().Get("X-Request-Id")
+	if len(actual) != 26 {
+		t.Errorf("Expected a generated request id, got %q", actual)
+	}
+
+	if received != "" {
+		t.Errorf("Request id should only be generated once it is used, got %q upstream", received)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Request-Id") == actual {
+		t.Error("Expected a new request id for every request")
+	}
+}
+
+func TestHeadersMiddlewareUpgrade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+	}))
+	defer upstream.Close()
+
+	cfg := config.HeadersConfig{
+		Response: config.HeaderRulesConfig{
+			Set: map[string]string{"X-Gateway": "yes"},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewHeadersMiddleware(&cfg))
+	r.GET("/ws", func(c *gin.Context) {
+		handlers.ProxyRequestHandler(c, upstream.URL, "/ws")
+	})
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req, _ := http.NewRequest("GET", gateway.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status code: %v, got %v", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	if actual := resp.Header.Get("X-Gateway"); actual != "yes" {
+		t.Errorf("Expected the response header rules to apply to the upgrade, got X-Gateway %q", actual)
+	}
+}
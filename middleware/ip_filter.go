@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bufio"
+	"cloud_gateway/config"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ipList is a set of ip ranges made of static entries and, optionally, the
+// entries of a file that is reloaded whenever its modification time changes
+type ipList struct {
+	static   []netip.Prefix
+	prefixes atomic.Pointer[[]netip.Prefix]
+	filepath string
+	modTime  time.Time
+}
+
+func newIPList(entries []string, filepath string, reloadInterval time.Duration) *ipList {
+	l := &ipList{filepath: filepath}
+	for _, entry := range entries {
+		prefix, err := ParseIPRange(entry)
+		if err != nil {
+			log.Fatalf("[IP FILTER] %v", err)
+		}
+		l.static = append(l.static, prefix)
+	}
+
+	if filepath == "" {
+		l.prefixes.Store(&l.static)
+		return l
+	}
+
+	if err := l.reload(); err != nil {
+		log.Fatalf("[IP FILTER] Failed to load ip list: %v", err)
+	}
+
+	go l.watch(reloadInterval)
+
+	return l
+}
+
+// defined reports whether the list was configured at all. An allow list
+// backed by a file that is currently empty still rejects everyone.
+func (l *ipList) defined() bool {
+	return len(l.static) > 0 || l.filepath != ""
+}
+
+func (l *ipList) contains(addr netip.Addr) bool {
+	for _, prefix := range *l.prefixes.Load() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ipList) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(l.filepath)
+		if err != nil {
+			log.Printf("[IP FILTER] Failed to stat ip list %s: %v", l.filepath, err)
+			continue
+		}
+
+		if info.ModTime().Equal(l.modTime) {
+			continue
+		}
+
+		// The previous list stays active if the new one is invalid
+		if err := l.reload(); err != nil {
+			log.Printf("[IP FILTER] Failed to reload ip list: %v", err)
+			continue
+		}
+		log.Printf("[IP FILTER] Reloaded ip list %s", l.filepath)
+	}
+}
+
+// reload reads the file, one ip range per line, ignoring blank lines and
+// '#' comments
+func (l *ipList) reload() error {
+	info, err := os.Stat(l.filepath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(l.filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	prefixes := append([]netip.Prefix{}, l.static...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		prefix, err := ParseIPRange(line)
+		if err != nil {
+			return fmt.Errorf("%s: %v", l.filepath, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.modTime = info.ModTime()
+	l.prefixes.Store(&prefixes)
+	return nil
+}
+
+// ParseIPRange parses a CIDR range or a single ip address into a prefix
+func ParseIPRange(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid ip range '%s'", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// NewIPFilterMiddleware rejects clients that are in the deny list or, when an
+// allow list is defined, are not in it. The client ip is resolved with
+// c.ClientIP() so forwarded headers are only honored from trusted proxies.
+func NewIPFilterMiddleware(cfg *config.IPFilterConfig) gin.HandlerFunc {
+	allow := newIPList(cfg.Allow, cfg.AllowFile, cfg.ReloadInterval)
+	deny := newIPList(cfg.Deny, cfg.DenyFile, cfg.ReloadInterval)
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		addr, err := netip.ParseAddr(clientIP)
+		if err != nil {
+			log.Printf("[IP FILTER] Rejected request with unparsable client ip '%s'", clientIP)
+			abortWithBody(c, cfg.RejectStatus, cfg.RejectBody)
+			return
+		}
+		addr = addr.Unmap()
+
+		if deny.contains(addr) || (allow.defined() && !allow.contains(addr)) {
+			log.Printf("[IP FILTER] Rejected request from client %s", clientIP)
+			abortWithBody(c, cfg.RejectStatus, cfg.RejectBody)
+			return
+		}
+
+		c.Next()
+	}
+}
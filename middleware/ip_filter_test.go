@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newIPFilterRouter(cfg *config.IPFilterConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+
+	r.Use(NewIPFilterMiddleware(cfg))
+	r.GET("/admin", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	return r
+}
+
+func doIPFilterRequest(r *gin.Engine, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.RemoteAddr = remoteAddr
+	// Must be ignored since no proxy is trusted
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	cfg := config.IPFilterConfig{
+		Allow:        []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"},
+		Deny:         []string{"10.1.0.0/16"},
+		RejectStatus: http.StatusForbidden,
+		RejectBody:   `{"error":"access denied"}`,
+	}
+	r := newIPFilterRouter(&cfg)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		expected   int
+	}{
+		{name: "allowed ipv4 range", remoteAddr: "10.2.3.4:1234", expected: http.StatusOK},
+		{name: "allowed single ip", remoteAddr: "192.0.2.1:1234", expected: http.StatusOK},
+		{name: "allowed ipv6 range", remoteAddr: "[2001:db8::1]:1234", expected: http.StatusOK},
+		{name: "denied range inside allowed range", remoteAddr: "10.1.2.3:1234", expected: http.StatusForbidden},
+		{name: "not in allow list", remoteAddr: "192.0.2.2:1234", expected: http.StatusForbidden},
+		{name: "ipv4 mapped ipv6", remoteAddr: "[::ffff:10.2.3.4]:1234", expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doIPFilterRequest(r, tc.remoteAddr)
+			if w.Code != tc.expected {
+				t.Errorf("Expected status code: %v, got %v", tc.expected, w.Code)
+			}
+
+			if tc.expected == http.StatusForbidden && w.Body.String() != cfg.RejectBody {
+				t.Errorf("Expected body string: %s, got %s", cfg.RejectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIPFilterMiddlewareFileReload(t *testing.T) {
+	denyFile := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(denyFile, []byte("# abusive networks\n198.51.100.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.IPFilterConfig{
+		DenyFile:       denyFile,
+		ReloadInterval: 10 * time.Millisecond,
+		RejectStatus:   http.StatusForbidden,
+		RejectBody:     "denied",
+	}
+	r := newIPFilterRouter(&cfg)
+
+	if w := doIPFilterRequest(r, "198.51.100.7:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code: %v, got %v", http.StatusForbidden, w.Code)
+	}
+	if w := doIPFilterRequest(r, "203.0.113.7:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+	}
+
+	// Make sure the modification time differs from the first write
+	later := time.Now().Add(time.Second)
+	if err := os.WriteFile(denyFile, []byte("203.0.113.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(denyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if w := doIPFilterRequest(r, "198.51.100.7:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code after reload: %v, got %v", http.StatusOK, w.Code)
+	}
+	if w := doIPFilterRequest(r, "203.0.113.7:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code after reload: %v, got %v", http.StatusForbidden, w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request headers that would let the upstream answer with 304 Not Modified
+var conditionalHeaders = []string{
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+}
+
+var noCacheHeaders = map[string]string{
+	"Cache-Control": "no-cache, no-store, no-transform, must-revalidate, private, max-age=0",
+	"Pragma":        "no-cache",
+	"Expires":       "Thu, 01 Jan 1970 00:00:00 GMT",
+}
+
+// NewNoCacheMiddleware prevents clients and intermediate caches from caching
+// responses. It applies to the configured path prefixes and response content
+// types, or to everything when they are not set.
+func NewNoCacheMiddleware(cfg *config.NoCachePolicyConfig) gin.HandlerFunc {
+	contentTypes := make([]string, 0, len(cfg.ContentTypes))
+	for _, contentType := range cfg.ContentTypes {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		contentTypes = append(contentTypes, mediaType)
+	}
+
+	return func(c *gin.Context) {
+		if len(cfg.Paths) != 0 && !slices.ContainsFunc(cfg.Paths, func(p string) bool {
+			// Prefixes match whole path segments, "/app" does not cover "/apple"
+			path := c.Request.URL.Path
+			return path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/")
+		}) {
+			c.Next()
+			return
+		}
+
+		// The content type of the response is unknown at this point, so
+		// conditional requests are only stripped when every type applies
+		if len(contentTypes) == 0 {
+			for _, h := range conditionalHeaders {
+				c.Request.Header.Del(h)
+			}
+		}
+
+		withHeaderHook(c, func(status int, header http.Header) {
+			if len(contentTypes) != 0 {
+				mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+				if !slices.Contains(contentTypes, mediaType) {
+					return
+				}
+			}
+
+			header.Del("ETag")
+			header.Del("Last-Modified")
+			for h, v := range noCacheHeaders {
+				header.Set(h, v)
+			}
+		})
+
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNoCacheMiddleware(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cfg           config.NoCachePolicyConfig
+		path          string
+		expectNoCache bool
+		expectStrip   bool
+	}{
+		{name: "applies everywhere by default", cfg: config.NoCachePolicyConfig{}, path: "/app/index.html", expectNoCache: true, expectStrip: true},
+		{name: "matching path", cfg: config.NoCachePolicyConfig{Paths: []string{"/app"}}, path: "/app/index.html", expectNoCache: true, expectStrip: true},
+		{name: "matching path with trailing slash", cfg: config.NoCachePolicyConfig{Paths: []string{"/app/"}}, path: "/app/index.html", expectNoCache: true, expectStrip: true},
+		{name: "exact path", cfg: config.NoCachePolicyConfig{Paths: []string{"/app/index.html"}}, path: "/app/index.html", expectNoCache: true, expectStrip: true},
+		{name: "path continuing the prefix segment", cfg: config.NoCachePolicyConfig{Paths: []string{"/ap"}}, path: "/app/index.html", expectNoCache: false, expectStrip: false},
+		{name: "other path", cfg: config.NoCachePolicyConfig{Paths: []string{"/api"}}, path: "/app/index.html", expectNoCache: false, expectStrip: false},
+		{name: "matching content type", cfg: config.NoCachePolicyConfig{ContentTypes: []string{"text/html"}}, path: "/app/index.html", expectNoCache: true, expectStrip: false},
+		{name: "other content type", cfg: config.NoCachePolicyConfig{ContentTypes: []string{"application/json"}}, path: "/app/index.html", expectNoCache: false, expectStrip: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received http.Header
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+
+			r.Use(NewNoCacheMiddleware(&tc.cfg))
+			r.GET("/app/index.html", func(c *gin.Context) {
+				received = c.Request.Header.Clone()
+				c.Header("ETag", `"v1"`)
+				c.Header("Cache-Control", "max-age=3600")
+				c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<html></html>"))
+			})
+
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("If-None-Match", `"v0"`)
+			req.Header.Set("If-Modified-Since", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			stripped := received.Get("If-None-Match") == "" && received.Get("If-Modified-Since") == ""
+			if stripped != tc.expectStrip {
+				t.Errorf("Expected conditional headers stripped: %v, got %v", tc.expectStrip, stripped)
+			}
+
+			if !tc.expectNoCache {
+				if w.Header().Get("Cache-Control") != "max-age=3600" || w.Header().Get("ETag") != `"v1"` {
+					t.Error("Response headers should have been left untouched")
+				}
+				return
+			}
+
+			for header, expected := range noCacheHeaders {
+				if actual := w.Header().Get(header); actual != expected {
+					t.Errorf("Expected %s: %q, got %q", header, expected, actual)
+				}
+			}
+			if w.Header().Get("ETag") != "" {
+				t.Error("ETag should have been removed")
+			}
+		})
+	}
+}
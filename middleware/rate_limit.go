@@ -1,29 +1,112 @@
 package middleware
 
 import (
+	"cloud_gateway/config"
+	"cloud_gateway/grpc"
+	"cloud_gateway/metrics"
+	"cloud_gateway/ratelimit"
+	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
-	ratelimiter "github.com/cizzle-cloud/rate-limiter"
 	"github.com/gin-gonic/gin"
 )
 
 //TODO: For future not rate limit only based per client IP?
 
-func NewRateLimitMiddleware(rl *ratelimiter.RateLimiter, algo ratelimiter.RateLimitAlgo) gin.HandlerFunc {
+func NewRateLimitMiddleware(name string, store *ratelimit.Store, cfg *config.RateLimitConfig) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		clientIP := c.ClientIP()
-		if !rl.Exists(clientIP) {
-			rl.Add(clientIP, algo)
+		result := store.Allow(clientIP)
+
+		if cfg.Mode == config.ModeDryRun {
+			if !result.Allowed {
+				log.Printf("[MIDDLEWARE] [DRY RUN] rate limit '%s' exceeded for client %s:", name, clientIP)
+				metrics.IncCounter("gateway_rate_limit_rejections_total", "limiter", name, "mode", cfg.Mode)
+			}
+			c.Next()
+			return
 		}
-		if !rl.Allow(clientIP) {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+
+		setRateLimitHeaders(c, result)
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(result.Reset), 1)))
 			log.Printf("[MIDDLEWARE] rate limit exceeded for client %s:", clientIP)
-			c.Abort()
+			metrics.IncCounter("gateway_rate_limit_rejections_total", "limiter", name, "mode", cfg.Mode)
+			abortWithBody(c, cfg.RejectStatus, cfg.RejectBody)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func NewConcurrencyLimitMiddleware(name string, cl *ratelimit.ConcurrencyLimiter, cfg *config.RateLimitConfig) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		result := cl.Acquire(clientIP)
+
+		if !result.Allowed {
+			metrics.IncCounter("gateway_rate_limit_rejections_total", "limiter", name, "mode", cfg.Mode)
+
+			if cfg.Mode == config.ModeDryRun {
+				log.Printf("[MIDDLEWARE] [DRY RUN] concurrency limit '%s' exceeded for client %s:", name, clientIP)
+				c.Next()
+				return
+			}
+
+			setRateLimitHeaders(c, result)
+			// A slot frees up once a request in flight completes, there is no
+			// reset to wait for
+			c.Header("Retry-After", "1")
+			log.Printf("[MIDDLEWARE] concurrency limit exceeded for client %s:", clientIP)
+			abortWithBody(c, cfg.RejectStatus, cfg.RejectBody)
 			return
 		}
+		defer cl.Release(clientIP)
+
+		if cfg.Mode != config.ModeDryRun {
+			setRateLimitHeaders(c, result)
+		}
 
 		c.Next()
 	}
 }
+
+// setRateLimitHeaders sets the headers of the IETF RateLimit header fields draft.
+// RateLimit-Reset is omitted when the algorithm has no notion of it.
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	if result.Reset > 0 {
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	}
+}
+
+// abortWithBody aborts the request with a configured rejection body, sent as
+// JSON when it is valid JSON and as plain text otherwise. gRPC calls get the
+// gRPC status matching the rejection instead.
+func abortWithBody(c *gin.Context, status int, body string) {
+	if grpc.IsCall(c.Request) {
+		grpc.Abort(c, status, http.StatusText(status))
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if json.Valid([]byte(body)) {
+		contentType = "application/json; charset=utf-8"
+	}
+
+	c.Data(status, contentType, []byte(body))
+	c.Abort()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"cloud_gateway/config"
+	"cloud_gateway/metrics"
+	"cloud_gateway/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		RejectStatus: http.StatusServiceUnavailable,
+		RejectBody:   `{"error":"slow down"}`,
+	}
+	store := ratelimit.NewStore(func() ratelimit.Algorithm {
+		return ratelimit.NewFixedWindowCounter(1, time.Minute)
+	}, time.Hour, time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.Use(NewRateLimitMiddleware("limiter", store, &cfg))
+	r.GET("/limited", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	req := httptest.NewRequest("GET", "/limited", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+	}
+
+	expectedHeaders := map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "",
+	}
+	for header, expected := range expectedHeaders {
+		if actual := w.Header().Get(header); actual != expected {
+			t.Errorf("Expected %s: %q, got %q", header, expected, actual)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code: %v, got %v", http.StatusServiceUnavailable, w.Code)
+	}
+
+	if w.Body.String() != cfg.RejectBody {
+		t.Errorf("Expected body string: %s, got %s", cfg.RejectBody, w.Body.String())
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("Expected json content type, got %s", contentType)
+	}
+
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("Expected Retry-After: %s, got %s", "60", retryAfter)
+	}
+}
+
+func TestRateLimitMiddlewareDryRun(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		RejectStatus: http.StatusTooManyRequests,
+		RejectBody:   `{"error":"rate limit exceeded"}`,
+		Mode:         config.ModeDryRun,
+	}
+	store := ratelimit.NewStore(func() ratelimit.Algorithm {
+		return ratelimit.NewFixedWindowCounter(1, time.Minute)
+	}, time.Hour, time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.Use(NewRateLimitMiddleware("dry_run_limiter", store, &cfg))
+	r.GET("/limited", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/limited", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+		}
+
+		if w.Header().Get("RateLimit-Limit") != "" {
+			t.Error("RateLimit headers should not be sent in dry run mode")
+		}
+	}
+
+	rejections := metrics.Value("gateway_rate_limit_rejections_total", "limiter", "dry_run_limiter", "mode", config.ModeDryRun)
+	if rejections != 2 {
+		t.Errorf("Expected %d dry run rejections, got %d", 2, rejections)
+	}
+}
+
+func TestConcurrencyLimitMiddlewareHeaders(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		RejectStatus: http.StatusTooManyRequests,
+		RejectBody:   `{"error":"too many requests in flight"}`,
+	}
+	cl := ratelimit.NewConcurrencyLimiter(1)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	r.Use(NewConcurrencyLimitMiddleware("concurrency_limiter", cl, &cfg))
+	r.GET("/limited", func(c *gin.Context) {
+		close(arrived)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"message": "OK"})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/limited", nil))
+	}()
+	<-arrived
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/limited", nil))
+	close(release)
+	<-done
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code: %v, got %v", http.StatusTooManyRequests, w.Code)
+	}
+
+	expectedHeaders := map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "",
+		"Retry-After":         "1",
+	}
+	for header, expected := range expectedHeaders {
+		if actual := w.Header().Get(header); actual != expected {
+			t.Errorf("Expected %s: %q, got %q", header, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerHookWriter calls hook exactly once, right before the response headers
+// are sent. This lets middleware adjust headers that are only known after the
+// handler ran, such as the ones copied from a proxied response. Like gin's own
+// writer, WriteHeader only records the status, the headers are sent with the
+// first write or an explicit WriteHeaderNow: hooking WriteHeader would run the
+// hook before gin sets the Content-Type of a rendered response. gin completes
+// responses without a body on its own writer, so handlers that may send none,
+// like the proxy and redirect handlers, call c.Writer.WriteHeaderNow.
+// Upgrades hijack the connection instead, the hook runs right before. The
+// reverse proxy adds the headers of the upstream 101 only after hijacking,
+// so the hook neither sees nor removes them.
+type headerHookWriter struct {
+	gin.ResponseWriter
+	hook   func(status int, header http.Header)
+	called bool
+}
+
+func withHeaderHook(c *gin.Context, hook func(status int, header http.Header)) {
+	c.Writer = &headerHookWriter{ResponseWriter: c.Writer, hook: hook}
+}
+
+func (w *headerHookWriter) callHook(status int) {
+	if w.called || w.ResponseWriter.Written() {
+		return
+	}
+	w.called = true
+	w.hook(status, w.Header())
+}
+
+func (w *headerHookWriter) WriteHeaderNow() {
+	w.callHook(w.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *headerHookWriter) Write(data []byte) (int, error) {
+	w.callHook(w.Status())
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *headerHookWriter) WriteString(s string) (int, error) {
+	w.callHook(w.Status())
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *headerHookWriter) Flush() {
+	w.callHook(w.Status())
+	w.ResponseWriter.Flush()
+}
+
+func (w *headerHookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.callHook(http.StatusSwitchingProtocols)
+	return w.ResponseWriter.Hijack()
+}
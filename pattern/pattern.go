@@ -0,0 +1,200 @@
+package pattern
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pattern is a path whose segments may contain:
+//
+//   - named parameters, "{id}", matching any value within a segment
+//   - named parameters with a regex constraint, "{id:[0-9]+}"
+//   - globs, "*" matching any value within a segment, e.g. "*.json"
+//   - a final "**" matching the rest of the path
+//
+// Patterns are registered with the router under a path where every dynamic
+// segment is a router parameter named after its position, so that patterns
+// sharing the same shape share a router path and are told apart by matching
+// their regex in order.
+type Pattern struct {
+	Raw string
+	// RouterPath is the path to register with gin, e.g. "/users/:p1"
+	RouterPath string
+	// Names are the names of the parameters in order
+	Names []string
+	// Constrained is set when the pattern does not match every request routed
+	// to its router path
+	Constrained bool
+	// CatchAll is set when the pattern ends with "**"
+	CatchAll bool
+	regex    *regexp.Regexp
+}
+
+// IsPattern reports whether p contains pattern syntax rather than being a
+// literal path
+func IsPattern(p string) bool {
+	return strings.ContainsAny(p, "{}*")
+}
+
+// Compile compiles a path pattern. With prefix set, the pattern also matches
+// paths continuing after it, like "/users/{id}" matching "/users/42/posts".
+func Compile(raw string, prefix bool) (*Pattern, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("pattern must start with '/'")
+	}
+
+	p := &Pattern{Raw: raw}
+	var routerPath, expr strings.Builder
+	expr.WriteString("^")
+
+	segments := strings.Split(raw[1:], "/")
+	for i, segment := range segments {
+		routerPath.WriteString("/")
+
+		switch {
+		case segment == "**":
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("'**' is only allowed as the last segment")
+			}
+			routerPath.WriteString("*p" + strconv.Itoa(i))
+			expr.WriteString("(?:/.*)?")
+			p.CatchAll = true
+			continue
+		case !IsPattern(segment):
+			routerPath.WriteString(segment)
+			expr.WriteString("/" + regexp.QuoteMeta(segment))
+			continue
+		}
+
+		segmentExpr, names, constrained, err := compileSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		routerPath.WriteString(":p" + strconv.Itoa(i))
+		expr.WriteString("/" + segmentExpr)
+		p.Names = append(p.Names, names...)
+		p.Constrained = p.Constrained || constrained
+	}
+
+	if prefix && !p.CatchAll {
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteString("$")
+
+	seen := make(map[string]bool)
+	for _, name := range p.Names {
+		if seen[name] {
+			return nil, fmt.Errorf("parameter '%s' is defined more than once", name)
+		}
+		seen[name] = true
+	}
+
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	p.regex = regex
+	p.RouterPath = routerPath.String()
+	return p, nil
+}
+
+// compileSegment returns the regex of a segment with parameters or globs
+func compileSegment(segment string) (string, []string, bool, error) {
+	var expr strings.Builder
+	var names []string
+	// A segment that is a single unconstrained parameter matches every value
+	constrained := true
+
+	for i := 0; i < len(segment); {
+		switch c := segment[i]; c {
+		case '*':
+			expr.WriteString("[^/]*")
+			i++
+		case '{':
+			// Constraints may contain braces themselves, e.g. "{id:[0-9]{3}}"
+			depth, end := 0, -1
+			for j := i; j < len(segment) && end == -1; j++ {
+				switch segment[j] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+					if depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end == -1 {
+				return "", nil, false, fmt.Errorf("unclosed '{' in segment '%s'", segment)
+			}
+
+			name, constraint, hasConstraint := strings.Cut(segment[i+1:end], ":")
+			if !isValidName(name) {
+				return "", nil, false, fmt.Errorf("invalid parameter name '%s'", name)
+			}
+			if !hasConstraint {
+				constraint = "[^/]+"
+				if i == 0 && end == len(segment)-1 {
+					constrained = false
+				}
+			} else if _, err := regexp.Compile(constraint); err != nil {
+				return "", nil, false, fmt.Errorf("invalid constraint of parameter '%s': %v", name, err)
+			}
+
+			expr.WriteString("(?P<" + name + ">" + constraint + ")")
+			names = append(names, name)
+			i = end + 1
+		case '}':
+			return "", nil, false, fmt.Errorf("unexpected '}' in segment '%s'", segment)
+		default:
+			j := i
+			for j < len(segment) && segment[j] != '*' && segment[j] != '{' && segment[j] != '}' {
+				j++
+			}
+			expr.WriteString(regexp.QuoteMeta(segment[i:j]))
+			i = j
+		}
+	}
+
+	return expr.String(), names, constrained, nil
+}
+
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Match matches a request path against the pattern and returns the values of
+// its parameters
+func (p *Pattern) Match(path string) (map[string]string, bool) {
+	match := p.regex.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(p.Names))
+	for i, name := range p.regex.SubexpNames() {
+		if name != "" {
+			params[name] = match[i]
+		}
+	}
+	return params, true
+}
+
+// Shadows reports whether every request matching other is already matched by
+// p, so that other can never be reached when p is tried first
+func (p *Pattern) Shadows(other *Pattern) bool {
+	if p.Raw == other.Raw {
+		return true
+	}
+	return p.RouterPath == other.RouterPath && !p.Constrained
+}
@@ -0,0 +1,109 @@
+package pattern
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	testCases := []struct {
+		raw                 string
+		prefix              bool
+		expectedRouterPath  string
+		expectedConstrained bool
+		expectedErr         string
+	}{
+		{raw: "/users/{id}", expectedRouterPath: "/users/:p1"},
+		{raw: "/users/{id:[0-9]+}", expectedRouterPath: "/users/:p1", expectedConstrained: true},
+		{raw: "/users/{id:[0-9]{3}}/posts", expectedRouterPath: "/users/:p1/posts", expectedConstrained: true},
+		{raw: "/files/*.json", expectedRouterPath: "/files/:p1", expectedConstrained: true},
+		{raw: "/files/**", expectedRouterPath: "/files/*p1"},
+		{raw: "/users/{id}", prefix: true, expectedRouterPath: "/users/:p1"},
+		{raw: "users/{id}", expectedErr: "pattern must start with '/'"},
+		{raw: "/files/**/raw", expectedErr: "'**' is only allowed as the last segment"},
+		{raw: "/users/{id", expectedErr: "unclosed '{' in segment '{id'"},
+		{raw: "/users/id}", expectedErr: "unexpected '}' in segment 'id}'"},
+		{raw: "/users/{user-id}", expectedErr: "invalid parameter name 'user-id'"},
+		{raw: "/users/{id}/posts/{id}", expectedErr: "parameter 'id' is defined more than once"},
+	}
+
+	for _, tc := range testCases {
+		p, err := Compile(tc.raw, tc.prefix)
+		if tc.expectedErr != "" {
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Errorf("Pattern %q: expected error %q, got %v", tc.raw, tc.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Pattern %q: unexpected error: %v", tc.raw, err)
+		}
+		if p.RouterPath != tc.expectedRouterPath {
+			t.Errorf("Pattern %q: expected router path %q, got %q", tc.raw, tc.expectedRouterPath, p.RouterPath)
+		}
+		if p.Constrained != tc.expectedConstrained {
+			t.Errorf("Pattern %q: expected constrained %v, got %v", tc.raw, tc.expectedConstrained, p.Constrained)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		raw            string
+		prefix         bool
+		path           string
+		expectedParams map[string]string
+		expectedMatch  bool
+	}{
+		{raw: "/users/{id}", path: "/users/42", expectedParams: map[string]string{"id": "42"}, expectedMatch: true},
+		{raw: "/users/{id}", path: "/users/42/posts"},
+		{raw: "/users/{id}", prefix: true, path: "/users/42/posts", expectedParams: map[string]string{"id": "42"}, expectedMatch: true},
+		{raw: "/users/{id:[0-9]+}", path: "/users/me"},
+		{raw: "/users/{id:[0-9]+}", path: "/users/42", expectedParams: map[string]string{"id": "42"}, expectedMatch: true},
+		{raw: "/v{version:[0-9]+}/{resource}", path: "/v2/orders", expectedParams: map[string]string{"version": "2", "resource": "orders"}, expectedMatch: true},
+		{raw: "/files/*.json", path: "/files/data.json", expectedParams: map[string]string{}, expectedMatch: true},
+		{raw: "/files/*.json", path: "/files/data.xml"},
+		{raw: "/files/*.json", path: "/files/dir/data.json"},
+		{raw: "/static/**", path: "/static/css/site.css", expectedParams: map[string]string{}, expectedMatch: true},
+		{raw: "/static/**", path: "/static", expectedParams: map[string]string{}, expectedMatch: true},
+		{raw: "/a.b/{id}", path: "/axb/1"},
+	}
+
+	for _, tc := range testCases {
+		p, err := Compile(tc.raw, tc.prefix)
+		if err != nil {
+			t.Fatalf("Pattern %q: unexpected error: %v", tc.raw, err)
+		}
+
+		params, ok := p.Match(tc.path)
+		if ok != tc.expectedMatch {
+			t.Errorf("Pattern %q, path %q: expected match %v, got %v", tc.raw, tc.path, tc.expectedMatch, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(params, tc.expectedParams) {
+			t.Errorf("Pattern %q, path %q: expected params %v, got %v", tc.raw, tc.path, tc.expectedParams, params)
+		}
+	}
+}
+
+func TestShadows(t *testing.T) {
+	testCases := []struct {
+		first    string
+		second   string
+		expected bool
+	}{
+		{first: "/users/{name}", second: "/users/{id:[0-9]+}", expected: true},
+		{first: "/users/{id:[0-9]+}", second: "/users/{name}", expected: false},
+		{first: "/files/*.json", second: "/files/*.json", expected: true},
+		{first: "/files/*.json", second: "/files/{name}", expected: false},
+		{first: "/users/{id}", second: "/users/{id}/posts", expected: false},
+	}
+
+	for _, tc := range testCases {
+		first, _ := Compile(tc.first, false)
+		second, _ := Compile(tc.second, false)
+		if actual := first.Shadows(second); actual != tc.expected {
+			t.Errorf("%q shadows %q: expected %v, got %v", tc.first, tc.second, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a single Allow call together with the quota state
+// of the key right after it, used to build the RateLimit-* response headers
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until more quota becomes available
+	Reset time.Duration
+}
+
+type Algorithm interface {
+	Allow() Result
+}
+
+// FixedWindowCounter allows up to limit requests per window. The window is
+// advanced lazily on each call instead of from a background ticker, so an
+// instance can be created per key without leaking goroutines.
+type FixedWindowCounter struct {
+	limit       int
+	windowSize  time.Duration
+	windowStart time.Time
+	count       int
+	mu          sync.Mutex
+}
+
+func NewFixedWindowCounter(limit int, windowSize time.Duration) *FixedWindowCounter {
+	return &FixedWindowCounter{
+		limit:       limit,
+		windowSize:  windowSize,
+		windowStart: time.Now(),
+	}
+}
+
+func (fw *FixedWindowCounter) Allow() Result {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := time.Now()
+	if windows := now.Sub(fw.windowStart) / fw.windowSize; windows > 0 {
+		fw.windowStart = fw.windowStart.Add(windows * fw.windowSize)
+		fw.count = 0
+	}
+
+	allowed := fw.count < fw.limit
+	if allowed {
+		fw.count++
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Limit:     fw.limit,
+		Remaining: fw.limit - fw.count,
+		Reset:     fw.windowStart.Add(fw.windowSize).Sub(now),
+	}
+}
+
+// TokenBucket holds up to capacity tokens and adds refillTokens every
+// refillInterval. Each request consumes a token.
+type TokenBucket struct {
+	capacity       int
+	tokens         int
+	refillTokens   int
+	refillInterval time.Duration
+	lastRefill     time.Time
+	mu             sync.Mutex
+}
+
+func NewTokenBucket(capacity, refillTokens int, refillInterval time.Duration) *TokenBucket {
+	return &TokenBucket{
+		capacity:       capacity,
+		tokens:         capacity,
+		refillTokens:   refillTokens,
+		refillInterval: refillInterval,
+		lastRefill:     time.Now(),
+	}
+}
+
+func (tb *TokenBucket) Allow() Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	if intervals := int(now.Sub(tb.lastRefill) / tb.refillInterval); intervals > 0 {
+		tb.tokens = min(tb.tokens+intervals*tb.refillTokens, tb.capacity)
+		tb.lastRefill = tb.lastRefill.Add(time.Duration(intervals) * tb.refillInterval)
+	}
+
+	allowed := tb.tokens > 0
+	if allowed {
+		tb.tokens--
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Limit:     tb.capacity,
+		Remaining: tb.tokens,
+		Reset:     tb.lastRefill.Add(tb.refillInterval).Sub(now),
+	}
+}
+
+// SlidingWindowLog keeps the timestamp of every accepted request and allows a
+// new one only if fewer than limit requests were accepted in the last window.
+// It is exact, at the cost of storing up to limit timestamps per key.
+type SlidingWindowLog struct {
+	limit      int
+	windowSize time.Duration
+	log        []time.Time
+	mu         sync.Mutex
+}
+
+func NewSlidingWindowLog(limit int, windowSize time.Duration) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		limit:      limit,
+		windowSize: windowSize,
+		log:        make([]time.Time, 0, limit),
+	}
+}
+
+func (sw *SlidingWindowLog) Allow() Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now()
+	sw.evict(now)
+
+	allowed := len(sw.log) < sw.limit
+	if allowed {
+		sw.log = append(sw.log, now)
+	}
+
+	// The oldest entry is the next one to leave the window
+	return Result{
+		Allowed:   allowed,
+		Limit:     sw.limit,
+		Remaining: sw.limit - len(sw.log),
+		Reset:     sw.log[0].Add(sw.windowSize).Sub(now),
+	}
+}
+
+// evict drops the timestamps that fell out of the window ending at now
+func (sw *SlidingWindowLog) evict(now time.Time) {
+	boundary := now.Add(-sw.windowSize)
+
+	idx := 0
+	for idx < len(sw.log) && !sw.log[idx].After(boundary) {
+		idx++
+	}
+	sw.log = sw.log[idx:]
+}
+
+// SlidingWindowCounter approximates a sliding window by weighting the count of
+// the previous fixed window with the portion of it still inside the sliding
+// window. It needs constant memory per key and smooths out the 2x burst a
+// fixed window allows at its boundaries.
+type SlidingWindowCounter struct {
+	limit       int
+	windowSize  time.Duration
+	windowStart time.Time
+	currCount   int
+	prevCount   int
+	mu          sync.Mutex
+}
+
+func NewSlidingWindowCounter(limit int, windowSize time.Duration) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		limit:       limit,
+		windowSize:  windowSize,
+		windowStart: time.Now(),
+	}
+}
+
+func (sw *SlidingWindowCounter) Allow() Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now()
+	sw.advance(now)
+
+	elapsed := now.Sub(sw.windowStart)
+	allowed := sw.estimate(elapsed) < float64(sw.limit)
+	if allowed {
+		sw.currCount++
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Limit:     sw.limit,
+		Remaining: max(sw.limit-int(sw.estimate(elapsed)+0.999999), 0),
+		Reset:     sw.nextAvailable(elapsed),
+	}
+}
+
+func (sw *SlidingWindowCounter) estimate(elapsed time.Duration) float64 {
+	prevWeight := 1 - float64(elapsed)/float64(sw.windowSize)
+	return float64(sw.prevCount)*prevWeight + float64(sw.currCount)
+}
+
+// nextAvailable returns how long until the weighted count drops below the
+// limit again. When the current window alone exhausts the limit that only
+// happens once the window ends.
+func (sw *SlidingWindowCounter) nextAvailable(elapsed time.Duration) time.Duration {
+	untilWindowEnd := sw.windowSize - elapsed
+	if sw.currCount >= sw.limit || sw.prevCount == 0 {
+		return untilWindowEnd
+	}
+
+	free := float64(sw.limit-sw.currCount) / float64(sw.prevCount)
+	wait := time.Duration(float64(sw.windowSize)*(1-free)) - elapsed
+	return min(max(wait, 0), untilWindowEnd)
+}
+
+// advance moves the current window forward so that it contains now
+func (sw *SlidingWindowCounter) advance(now time.Time) {
+	windows := int(now.Sub(sw.windowStart) / sw.windowSize)
+	if windows <= 0 {
+		return
+	}
+
+	if windows == 1 {
+		sw.prevCount = sw.currCount
+	} else {
+		// More than a whole window passed without requests
+		sw.prevCount = 0
+	}
+	sw.currCount = 0
+	sw.windowStart = sw.windowStart.Add(time.Duration(windows) * sw.windowSize)
+}
+
+// ConcurrencyLimiter caps the number of requests in flight per key. Unlike the
+// other algorithms every successful Acquire must be paired with a Release once
+// the request completes.
+type ConcurrencyLimiter struct {
+	limit    int
+	inFlight map[string]int
+	mu       sync.Mutex
+}
+
+func NewConcurrencyLimiter(limit int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limit:    limit,
+		inFlight: make(map[string]int),
+	}
+}
+
+// Acquire reserves a slot for key. The result carries no Reset since a slot
+// frees up only when a request in flight completes.
+func (cl *ConcurrencyLimiter) Acquire(key string) Result {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	allowed := cl.inFlight[key] < cl.limit
+	if allowed {
+		cl.inFlight[key]++
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Limit:     cl.limit,
+		Remaining: cl.limit - cl.inFlight[key],
+	}
+}
+
+func (cl *ConcurrencyLimiter) Release(key string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	// Keys without requests in flight are dropped so the map does not grow
+	// with every client ever seen
+	if cl.inFlight[key] <= 1 {
+		delete(cl.inFlight, key)
+		return
+	}
+	cl.inFlight[key]--
+}
+
+// Len returns the number of keys with requests in flight
+func (cl *ConcurrencyLimiter) Len() int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return len(cl.inFlight)
+}
+
+func (cl *ConcurrencyLimiter) InFlight(key string) int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return cl.inFlight[key]
+}
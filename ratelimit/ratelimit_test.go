@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedWindowCounter(t *testing.T) {
+	fw := NewFixedWindowCounter(2, 100*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if !fw.Allow().Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	result := fw.Allow()
+	if result.Allowed {
+		t.Error("Expected request over the limit to be denied")
+	}
+	if result.Limit != 2 || result.Remaining != 0 {
+		t.Errorf("Expected limit 2 and remaining 0, got %d and %d", result.Limit, result.Remaining)
+	}
+	if result.Reset <= 0 || result.Reset > 100*time.Millisecond {
+		t.Errorf("Expected reset within the window, got %v", result.Reset)
+	}
+
+	time.Sleep(result.Reset + 10*time.Millisecond)
+
+	result = fw.Allow()
+	if !result.Allowed || result.Remaining != 1 {
+		t.Errorf("Expected a fresh window, got %+v", result)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(2, 1, 100*time.Millisecond)
+
+	result := tb.Allow()
+	if !result.Allowed || result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Expected first request to be allowed with 1 token left, got %+v", result)
+	}
+
+	tb.Allow()
+	if tb.Allow().Allowed {
+		t.Error("Expected request on an empty bucket to be denied")
+	}
+
+	time.Sleep(110 * time.Millisecond)
+
+	if !tb.Allow().Allowed {
+		t.Error("Expected request to be allowed after a refill")
+	}
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	sw := NewSlidingWindowLog(3, 100*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if !sw.Allow().Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	result := sw.Allow()
+	if result.Allowed {
+		t.Error("Expected request over the limit to be denied")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected remaining 0, got %d", result.Remaining)
+	}
+
+	time.Sleep(result.Reset + 10*time.Millisecond)
+
+	if !sw.Allow().Allowed {
+		t.Error("Expected request to be allowed after the window slid")
+	}
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	sw := NewSlidingWindowCounter(4, 100*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		if !sw.Allow().Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	if sw.Allow().Allowed {
+		t.Error("Expected request over the limit to be denied")
+	}
+
+	// Right after the boundary most of the previous window still counts, so
+	// a fixed window style burst must not be allowed
+	sw.mu.Lock()
+	sw.windowStart = sw.windowStart.Add(-110 * time.Millisecond)
+	sw.mu.Unlock()
+
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		if sw.Allow().Allowed {
+			allowed++
+		}
+	}
+	if allowed == 0 || allowed >= 4 {
+		t.Errorf("Expected a partial burst after the boundary, got %d allowed", allowed)
+	}
+
+	// Two whole windows later the previous count no longer applies
+	sw.mu.Lock()
+	sw.windowStart = sw.windowStart.Add(-200 * time.Millisecond)
+	sw.mu.Unlock()
+
+	for i := 0; i < 4; i++ {
+		if !sw.Allow().Allowed {
+			t.Fatalf("Expected request %d to be allowed after idle windows", i+1)
+		}
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	cl := NewConcurrencyLimiter(2)
+
+	if !cl.Acquire("a").Allowed || !cl.Acquire("a").Allowed {
+		t.Fatal("Expected requests within the limit to be allowed")
+	}
+
+	if cl.Acquire("a").Allowed {
+		t.Error("Expected request over the limit to be denied")
+	}
+
+	if result := cl.Acquire("b"); !result.Allowed || result.Remaining != 1 {
+		t.Errorf("Expected limit to be tracked per key, got %+v", result)
+	}
+
+	cl.Release("a")
+	if !cl.Acquire("a").Allowed {
+		t.Error("Expected request to be allowed after a release")
+	}
+
+	cl.Release("a")
+	cl.Release("a")
+	cl.Release("b")
+	if len(cl.inFlight) != 0 {
+		t.Errorf("Expected idle keys to be dropped, got %v", cl.inFlight)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(func() Algorithm { return NewFixedWindowCounter(1, time.Hour) }, 50*time.Millisecond, 20*time.Millisecond)
+
+	if !s.Allow("a").Allowed {
+		t.Error("Expected first request of key 'a' to be allowed")
+	}
+	if s.Allow("a").Allowed {
+		t.Error("Expected second request of key 'a' to be denied")
+	}
+	if !s.Allow("b").Allowed {
+		t.Error("Expected keys to have separate quotas")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if s.Len() != 0 {
+		t.Errorf("Expected inactive keys to be cleaned up, got %d", s.Len())
+	}
+}
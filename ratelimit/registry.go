@@ -0,0 +1,20 @@
+package ratelimit
+
+// KeyCounter is a rate limiter tracking state per key, a Store or a
+// ConcurrencyLimiter
+type KeyCounter interface {
+	Len() int
+}
+
+// KeyCounts returns the number of keys currently tracked by the limiters of
+// every rate limiter by name. Every reference of a rate limiter middleware has
+// a limiter of its own, their keys are summed up.
+func KeyCounts(limiters map[string][]KeyCounter) map[string]int {
+	counts := make(map[string]int, len(limiters))
+	for name, registered := range limiters {
+		for _, limiter := range registered {
+			counts[name] += limiter.Len()
+		}
+	}
+	return counts
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type record struct {
+	algo       Algorithm
+	lastActive time.Time
+}
+
+// Store keeps a separate algorithm instance per key, created on first use
+// with newAlgo, and forgets keys that have been inactive for longer than ttl
+type Store struct {
+	records map[string]*record
+	newAlgo func() Algorithm
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+func NewStore(newAlgo func() Algorithm, ttl, cleanupInterval time.Duration) *Store {
+	s := &Store{
+		records: make(map[string]*record),
+		newAlgo: newAlgo,
+		ttl:     ttl,
+	}
+
+	go s.cleanup(cleanupInterval)
+
+	return s
+}
+
+func (s *Store) Allow(key string) Result {
+	s.mu.Lock()
+	rec, ok := s.records[key]
+	if !ok {
+		rec = &record{algo: s.newAlgo()}
+		s.records[key] = rec
+	}
+	rec.lastActive = time.Now()
+	s.mu.Unlock()
+
+	return rec.algo.Allow()
+}
+
+// Len returns the number of keys currently tracked
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.records)
+}
+
+func (s *Store) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, rec := range s.records {
+			if now.Sub(rec.lastActive) > s.ttl {
+				delete(s.records, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
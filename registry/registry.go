@@ -1,14 +1,23 @@
 package registry
 
 import (
+	"cloud_gateway/cache"
 	"cloud_gateway/config"
+	"cloud_gateway/grpc"
 	"cloud_gateway/handlers"
 	"cloud_gateway/middleware"
+	"cloud_gateway/pattern"
+	"cloud_gateway/ratelimit"
 	"cloud_gateway/route"
+	"cloud_gateway/upstream"
+	"context"
+	"fmt"
 	"log"
-	"path"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 
-	ratelimiter "github.com/cizzle-cloud/rate-limiter"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,32 +27,104 @@ const (
 )
 
 type RouteRegistry struct {
-	Routes       []route.Route
-	DomainRoutes []route.DomainRoute
+	Routes         []route.Route
+	DomainRoutes   []route.DomainRoute
+	TrustedProxies []string
+	// Balancers are the balancers of the routes and domain routes with weighted
+	// targets by name
+	Balancers map[string]*upstream.Balancer
+	// RateLimiters are the limiters of the rate limiter middleware by name,
+	// every reference of a middleware has one of its own
+	RateLimiters map[string][]ratelimit.KeyCounter
+	// ipFilters are the ip filter middleware by name, built once per parse
+	ipFilters map[string]gin.HandlerFunc
+	// domainHandlers serve requests of pattern routes whose patterns all
+	// failed to match, like requests no route matched
+	domainHandlers map[string]http.Handler
 }
 
 func (rr *RouteRegistry) FromConfig(cfg *config.Config) {
+	rr.Balancers = nil
+	rr.RateLimiters = nil
+	rr.ipFilters = nil
 	rr.ParseRoutes(cfg)
 	rr.ParseDomainRoutes(cfg)
+	if cfg.Env != nil {
+		rr.TrustedProxies = cfg.Env.TrustedProxies
+	}
 }
 
-func resolveMiddlewareGroup(middlewareGroup string, cfg *config.Config) []gin.HandlerFunc {
+func (rr *RouteRegistry) resolveMiddlewareGroup(middlewareGroup string, cfg *config.Config) []gin.HandlerFunc {
 	grp, ok := cfg.MiddlewareGroups[middlewareGroup]
 	if !ok {
 		return nil
 	}
 
-	return resolveMiddlewareList(*grp, cfg)
+	return rr.resolveMiddlewareList(*grp, cfg)
+}
+
+// middlewareNames returns the names of the middleware of the group followed by
+// the listed ones, in the order they run
+func middlewareNames(middlewareGroup string, middleware []string, cfg *config.Config) []string {
+	var names []string
+	if grp, ok := cfg.MiddlewareGroups[middlewareGroup]; ok {
+		names = append(names, *grp...)
+	}
+	return append(names, middleware...)
+}
+
+// usesCORS reports whether a cors middleware is referenced directly or through
+// the middleware group
+func usesCORS(middlewareGroup string, middleware []string, cfg *config.Config) bool {
+	for _, name := range middlewareNames(middlewareGroup, middleware, cfg) {
+		if _, ok := cfg.CORS[name]; ok {
+			return true
+		}
+	}
+	return false
 }
 
-func resolveMiddleware(mw string, cfg *config.Config) gin.HandlerFunc {
+func (rr *RouteRegistry) resolveMiddleware(mw string, cfg *config.Config) gin.HandlerFunc {
 	var handler gin.HandlerFunc
 
-	if rateLimitCfg, ok := cfg.RateLimiters[mw]; ok {
-		algo, rl := ParseRateLimitCfg(rateLimitCfg)
-		handler = middleware.NewRateLimitMiddleware(algo, rl)
+	if rateLimitCfg, ok := cfg.RateLimiters[mw]; ok && rateLimitCfg.Algorithm == "concurrency" {
+		cl := ratelimit.NewConcurrencyLimiter(rateLimitCfg.Limit)
+		rr.addRateLimiter(mw, cl)
+		handler = middleware.NewConcurrencyLimitMiddleware(mw, cl, rateLimitCfg)
+	} else if ok {
+		store := ParseRateLimitCfg(rateLimitCfg)
+		rr.addRateLimiter(mw, store)
+		handler = middleware.NewRateLimitMiddleware(mw, store, rateLimitCfg)
 	} else if forwardAuthCfg, ok := cfg.ForwardAuth[mw]; ok {
-		handler = middleware.NewForwardAuthMiddleware(forwardAuthCfg)
+		handler = middleware.NewForwardAuthMiddleware(mw, forwardAuthCfg)
+	} else if ipFilterCfg, ok := cfg.IPFilters[mw]; ok {
+		// Every reference shares the lists of the filter and their watchers
+		if rr.ipFilters == nil {
+			rr.ipFilters = make(map[string]gin.HandlerFunc)
+		}
+		if _, ok := rr.ipFilters[mw]; !ok {
+			rr.ipFilters[mw] = middleware.NewIPFilterMiddleware(ipFilterCfg)
+		}
+		handler = rr.ipFilters[mw]
+	} else if geoIPCfg, ok := cfg.GeoIP[mw]; ok {
+		handler = middleware.NewGeoIPMiddleware(geoIPCfg)
+	} else if corsCfg, ok := cfg.CORS[mw]; ok {
+		handler = middleware.NewCORSMiddleware(corsCfg)
+	} else if headersCfg, ok := cfg.Headers[mw]; ok {
+		handler = middleware.NewHeadersMiddleware(headersCfg)
+	} else if noCachePolicyCfg, ok := cfg.NoCachePolicies[mw]; ok {
+		handler = middleware.NewNoCacheMiddleware(noCachePolicyCfg)
+	} else if cacheCfg, ok := cfg.Caches[mw]; ok {
+		store := cache.Named(mw, func() *cache.Store {
+			return cache.NewStore(cacheCfg.MaxSize, cacheCfg.DiskPath)
+		})
+		handler = middleware.NewCacheMiddleware(mw, store, cacheCfg)
+	} else if coalescingCfg, ok := cfg.Coalescing[mw]; ok {
+		handler = middleware.NewCoalescingMiddleware(mw, coalescingCfg)
+	} else if compressionCfg, ok := cfg.Compression[mw]; ok {
+		handler = middleware.NewCompressionMiddleware(compressionCfg)
+	} else if bodyLimitCfg, ok := cfg.BodyLimits[mw]; ok {
+		handler = middleware.NewBodyLimitMiddleware(bodyLimitCfg)
 	} else {
 		log.Fatalf("[ERROR] Unknown or unsupported middleware: %s", mw)
 	}
@@ -51,65 +132,293 @@ func resolveMiddleware(mw string, cfg *config.Config) gin.HandlerFunc {
 	return handler
 }
 
-func resolveMiddlewareList(mwl []string, cfg *config.Config) []gin.HandlerFunc {
+func (rr *RouteRegistry) addRateLimiter(name string, limiter ratelimit.KeyCounter) {
+	if rr.RateLimiters == nil {
+		rr.RateLimiters = make(map[string][]ratelimit.KeyCounter)
+	}
+	rr.RateLimiters[name] = append(rr.RateLimiters[name], limiter)
+}
+
+func (rr *RouteRegistry) resolveMiddlewareList(mwl []string, cfg *config.Config) []gin.HandlerFunc {
 	var handlers []gin.HandlerFunc
 
 	for _, mw := range mwl {
-		handlers = append(handlers, resolveMiddleware(mw, cfg))
+		handlers = append(handlers, rr.resolveMiddleware(mw, cfg))
 	}
 
 	return handlers
 }
 
-func ParseRateLimitCfg(cfg *config.RateLimitConfig) (*ratelimiter.RateLimiter, ratelimiter.RateLimitAlgo) {
-	var algo ratelimiter.RateLimitAlgo
+// ParseRateLimitCfg returns a store that keeps a separate instance of the
+// configured algorithm for each client key
+func ParseRateLimitCfg(cfg *config.RateLimitConfig) *ratelimit.Store {
+	var newAlgo func() ratelimit.Algorithm
 
 	switch algoType := cfg.Algorithm; algoType {
 	case "fixed_window_counter":
-		algo = ratelimiter.NewFixedWindowCounter(cfg.Limit, cfg.WindowSize)
+		newAlgo = func() ratelimit.Algorithm {
+			return ratelimit.NewFixedWindowCounter(cfg.Limit, cfg.WindowSize)
+		}
 	case "token_bucket":
-		algo = ratelimiter.NewTokenBucket(cfg.Capacity, cfg.RefillTokens, cfg.RefillInterval)
+		newAlgo = func() ratelimit.Algorithm {
+			return ratelimit.NewTokenBucket(cfg.Capacity, cfg.RefillTokens, cfg.RefillInterval)
+		}
+	case "sliding_window_log":
+		newAlgo = func() ratelimit.Algorithm {
+			return ratelimit.NewSlidingWindowLog(cfg.Limit, cfg.WindowSize)
+		}
+	case "sliding_window_counter":
+		newAlgo = func() ratelimit.Algorithm {
+			return ratelimit.NewSlidingWindowCounter(cfg.Limit, cfg.WindowSize)
+		}
 	}
 
-	rl := ratelimiter.NewRateLimiter(cfg.Ttl, cfg.CleanupInterval)
+	return ratelimit.NewStore(newAlgo, cfg.Ttl, cfg.CleanupInterval)
+}
 
-	return rl, algo
+// ParseRewriteCfg compiles the rewrite rules of a route, the regex has been
+// validated with the config already
+func ParseRewriteCfg(cfg *config.RewriteConfig) *route.Rewrite {
+	if cfg == nil {
+		return nil
+	}
+
+	rewrite := &route.Rewrite{
+		StripPrefix:    cfg.StripPrefix,
+		AddPrefix:      cfg.AddPrefix,
+		Replacement:    cfg.Replacement,
+		PreservePrefix: cfg.PreservePrefix,
+	}
+	if cfg.Regex != "" {
+		rewrite.Regex = regexp.MustCompile(cfg.Regex)
+	}
+	return rewrite
+}
+
+// ParseMatchCfg compiles the match predicates of a route, regexes and ip
+// ranges have been validated with the config already
+func ParseMatchCfg(cfg *config.MatchConfig) *route.Match {
+	if cfg == nil {
+		return nil
+	}
+
+	parseRules := func(rules []*config.MatchRuleConfig) []route.MatchRule {
+		var parsed []route.MatchRule
+		for _, rule := range rules {
+			matchRule := route.MatchRule{Name: rule.Name, Equals: rule.Equals}
+			if rule.Regex != "" {
+				matchRule.Regex = regexp.MustCompile(rule.Regex)
+			}
+			parsed = append(parsed, matchRule)
+		}
+		return parsed
+	}
+
+	match := &route.Match{
+		Headers: parseRules(cfg.Headers),
+		Query:   parseRules(cfg.Query),
+		Cookies: parseRules(cfg.Cookies),
+	}
+	for _, cidr := range cfg.ClientCIDRs {
+		prefix, err := middleware.ParseIPRange(cidr)
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		match.ClientCIDRs = append(match.ClientCIDRs, prefix)
+	}
+	return match
+}
+
+// ParseTargetsCfg returns the weighted targets of a route
+func ParseTargetsCfg(cfg []*config.WeightedTargetConfig) []upstream.Target {
+	targets := make([]upstream.Target, 0, len(cfg))
+	for _, t := range cfg {
+		targets = append(targets, upstream.Target{URL: t.URL, Weight: t.Weight})
+	}
+	return targets
+}
+
+// parseBalancer returns a new balancer for a route with weighted targets. It is
+// registered by the position of the route so that a reload of the targets
+// finds it, replacing the balancer of a previous parse.
+func (rr *RouteRegistry) parseBalancer(name string, targets []*config.WeightedTargetConfig, sticky *config.StickyConfig, healthCheck *config.HealthCheckConfig) *upstream.Balancer {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var s *upstream.Sticky
+	if sticky != nil {
+		s = &upstream.Sticky{
+			Cookie:     sticky.Cookie,
+			HashCookie: sticky.HashCookie,
+			Header:     sticky.Header,
+			ClientIP:   sticky.ClientIP,
+		}
+	}
+
+	b := upstream.NewBalancer(name, ParseTargetsCfg(targets), s)
+	if healthCheck != nil {
+		b.StartHealthChecks(upstream.HealthCheck{
+			Path:               healthCheck.Path,
+			Interval:           healthCheck.Interval,
+			Timeout:            healthCheck.Timeout,
+			UnhealthyThreshold: healthCheck.UnhealthyThreshold,
+			HealthyThreshold:   healthCheck.HealthyThreshold,
+		})
+	}
+
+	if rr.Balancers == nil {
+		rr.Balancers = make(map[string]*upstream.Balancer)
+	}
+	rr.Balancers[name] = b
+	upstream.Register(name, b)
+	return b
+}
+
+// ParseMirrorCfg returns the mirror of a route, the config has been validated
+// and defaulted already
+func ParseMirrorCfg(cfg *config.MirrorConfig) *upstream.Mirror {
+	if cfg == nil {
+		return nil
+	}
+	return upstream.NewMirror(cfg.Target, cfg.Percentage, cfg.MaxBodySize, cfg.Timeout)
+}
+
+// ParseWebSocketCfg returns the WebSocket limits of a route, the connections
+// of all its paths count towards the same limit
+func ParseWebSocketCfg(name string, cfg *config.WebSocketConfig) *upstream.WebSocket {
+	if cfg == nil {
+		return nil
+	}
+	return upstream.NewWebSocket(name, cfg.MaxConnections, cfg.IdleTimeout, cfg.MaxLifetime)
+}
+
+func routeBalancerName(i int, r *config.RouteConfig) string {
+	return fmt.Sprintf("routes[%d] %s", i, r.Prefix)
+}
+
+func domainBalancerName(i int, r *config.DomainRouteConfig) string {
+	return fmt.Sprintf("domain_routes[%d] %s", i, r.Domain)
+}
+
+// ReloadTargets updates the weighted targets of the running routes from cfg.
+// Routes are found by their position, other changes need a restart.
+func ReloadTargets(cfg *config.Config) {
+	reload := func(name string, targets []*config.WeightedTargetConfig) {
+		if len(targets) == 0 {
+			return
+		}
+
+		b, ok := upstream.Lookup(name)
+		if !ok {
+			log.Printf("[RELOAD] Route %s has no weighted targets running, restart to apply them", name)
+			return
+		}
+		b.SetTargets(ParseTargetsCfg(targets))
+		log.Printf("[RELOAD] Updated the targets of route %s", name)
+	}
+
+	for i, r := range cfg.Routes {
+		reload(routeBalancerName(i, r), r.Targets)
+	}
+	for i, r := range cfg.DomainRoutes {
+		reload(domainBalancerName(i, r), r.Targets)
+	}
 }
 
 func (rr *RouteRegistry) ParseRoutes(cfg *config.Config) {
 	var routes []route.Route
 
-	for _, r := range cfg.Routes {
+	for i, r := range cfg.Routes {
 
 		resolvedMiddleware := append(
-			resolveMiddlewareGroup(r.MiddlewareGroup, cfg),
-			resolveMiddlewareList(r.Middleware, cfg)...,
+			rr.resolveMiddlewareGroup(r.MiddlewareGroup, cfg),
+			rr.resolveMiddlewareList(r.Middleware, cfg)...,
 		)
-
-		if r.ProxyTarget != "" {
-			routes = append(routes, handleProxyRoute(r, resolvedMiddleware))
+		names := middlewareNames(r.MiddlewareGroup, r.Middleware, cfg)
+
+		if r.ProxyTarget != "" || len(r.Targets) != 0 {
+			proxyRoute := handleProxyRoute(r, resolvedMiddleware).WithMiddlewareNames(names).
+				WithRewrite(ParseRewriteCfg(r.Rewrite)).WithMatch(ParseMatchCfg(r.Match)).
+				WithBalancer(rr.parseBalancer(routeBalancerName(i, r), r.Targets, r.Sticky, r.HealthCheck)).
+				WithMirror(ParseMirrorCfg(r.Mirror)).WithWebSocket(ParseWebSocketCfg(r.Prefix, r.WebSocket)).
+				WithGRPCWeb(r.GRPCWeb)
+			if usesCORS(r.MiddlewareGroup, r.Middleware, cfg) {
+				proxyRoute = proxyRoute.WithPreflight()
+			}
+			routes = append(routes, withListeners(forMethods(proxyRoute, r.Method, r.Methods), r.Listeners)...)
 			continue
 		}
 
 		if r.RedirectTarget != "" {
-			routes = append(
-				routes,
-				route.NewRoute(
-					r.Method,
-					r.Prefix,
-					r.Prefix,
-					resolvedMiddleware,
-				).WithRedirect(r.RedirectTarget, r.RedirectCode),
-			)
+			redirectRoute := route.NewRoute(
+				r.Method,
+				r.Prefix,
+				r.Prefix,
+				resolvedMiddleware,
+			).WithRedirect(r.RedirectTarget, r.RedirectCode).WithMatch(ParseMatchCfg(r.Match)).
+				WithMiddlewareNames(names)
+			if usesCORS(r.MiddlewareGroup, r.Middleware, cfg) {
+				redirectRoute = redirectRoute.WithPreflight()
+			}
+			routes = append(routes, withListeners(forMethods(redirectRoute, r.Method, r.Methods), r.Listeners)...)
 			continue
 		}
 
-		routes = append(routes, handlePathRoutes(r, cfg, resolvedMiddleware)...)
+		pathRoutes := rr.handlePathRoutes(r, cfg, resolvedMiddleware, ParseWebSocketCfg(r.Prefix, r.WebSocket))
+		routes = append(routes, withListeners(pathRoutes, r.Listeners)...)
 	}
 
 	rr.Routes = routes
 }
 
+// withListeners sets the listeners serving the routes of a route config
+func withListeners(routes []route.Route, listeners []string) []route.Route {
+	for i := range routes {
+		routes[i] = routes[i].WithListeners(listeners)
+	}
+	return routes
+}
+
+// ForListener returns the registry of the routes and domain routes served by
+// the listener name, routes naming no listener are served by the default one
+func (rr *RouteRegistry) ForListener(name string) *RouteRegistry {
+	servedBy := func(listeners []string) bool {
+		if len(listeners) == 0 {
+			return name == config.DefaultListener
+		}
+		return slices.Contains(listeners, name)
+	}
+
+	filtered := &RouteRegistry{TrustedProxies: rr.TrustedProxies}
+	for _, rt := range rr.Routes {
+		if servedBy(rt.Listeners) {
+			filtered.Routes = append(filtered.Routes, rt)
+		}
+	}
+	for _, dr := range rr.DomainRoutes {
+		if servedBy(dr.Listeners) {
+			filtered.DomainRoutes = append(filtered.DomainRoutes, dr)
+		}
+	}
+	return filtered
+}
+
+// forMethods returns a copy of rt for every http method of its route or path
+func forMethods(rt route.Route, method string, methods []string) []route.Route {
+	expanded := config.ExpandMethods(method, methods)
+	if len(expanded) == 0 {
+		return []route.Route{rt}
+	}
+
+	routes := make([]route.Route, 0, len(expanded))
+	for _, m := range expanded {
+		rt.Method = m
+		routes = append(routes, rt)
+	}
+	return routes
+}
+
 // Handle Proxy Target for prefix routes where no specific paths are defined
 func handleProxyRoute(r *config.RouteConfig, resolvedMiddleware []gin.HandlerFunc) route.Route {
 	if r.Prefix == "" || r.Prefix == "/" {
@@ -120,14 +429,14 @@ func handleProxyRoute(r *config.RouteConfig, resolvedMiddleware []gin.HandlerFun
 }
 
 // Handle individual paths under the prefix
-func handlePathRoutes(r *config.RouteConfig, cfg *config.Config, resolvedRouteMiddleware []gin.HandlerFunc) []route.Route {
+func (rr *RouteRegistry) handlePathRoutes(r *config.RouteConfig, cfg *config.Config, resolvedRouteMiddleware []gin.HandlerFunc, ws *upstream.WebSocket) []route.Route {
 	var pathRoutes []route.Route
 
 	for _, path := range r.Paths {
 
 		resolvedPathMiddleware := append(
-			resolveMiddlewareGroup(path.MiddlewareGroup, cfg),
-			resolveMiddlewareList(path.Middleware, cfg)...,
+			rr.resolveMiddlewareGroup(path.MiddlewareGroup, cfg),
+			rr.resolveMiddlewareList(path.Middleware, cfg)...,
 		)
 
 		resolvedMiddleware := append(
@@ -136,22 +445,65 @@ func handlePathRoutes(r *config.RouteConfig, cfg *config.Config, resolvedRouteMi
 		)
 
 		fixedPath := path.Path
+		relativePath := r.Prefix + fixedPath
+
+		// Patterns are registered under their router path and told apart from
+		// patterns sharing it when a request comes in
+		var pathPattern *pattern.Pattern
+		if pattern.IsPattern(fixedPath) {
+			var err error
+			pathPattern, err = pattern.Compile(strings.TrimSuffix(r.Prefix, "/")+fixedPath, path.ProxyTarget != "")
+			if err != nil {
+				log.Fatalf("[ERROR] Invalid path pattern '%s': %v", fixedPath, err)
+			}
+			relativePath = pathPattern.RouterPath
+		}
+
 		var pathRoute route.Route
 		if path.ProxyTarget != "" {
-			pathRoute = route.NewRoute(path.Method, r.Prefix, r.Prefix+fixedPath+"/*path", resolvedMiddleware).
-				WithFixedPath(fixedPath).WithProxy(path.ProxyTarget)
+			// Paths without a rewrite of their own use the one of their route
+			rewriteCfg := path.Rewrite
+			if rewriteCfg == nil {
+				rewriteCfg = r.Rewrite
+			}
+
+			proxyPath := relativePath + "/*path"
+			if pathPattern != nil && pathPattern.CatchAll {
+				proxyPath = relativePath
+			}
+
+			// The same goes for the mirror
+			mirrorCfg := path.Mirror
+			if mirrorCfg == nil {
+				mirrorCfg = r.Mirror
+			}
+
+			pathRoute = route.NewRoute(path.Method, r.Prefix, proxyPath, resolvedMiddleware).
+				WithFixedPath(fixedPath).WithProxy(path.ProxyTarget).WithRewrite(ParseRewriteCfg(rewriteCfg)).
+				WithMirror(ParseMirrorCfg(mirrorCfg)).WithWebSocket(ws).WithGRPCWeb(r.GRPCWeb)
 		}
 
 		if path.RedirectTarget != "" {
 			pathRoute = route.NewRoute(
 				path.Method,
 				r.Prefix,
-				r.Prefix+fixedPath,
+				relativePath,
 				resolvedMiddleware,
 			).WithFixedPath(fixedPath).WithRedirect(path.RedirectTarget, path.RedirectCode)
 		}
 
-		pathRoutes = append(pathRoutes, pathRoute)
+		// Paths only serve the requests satisfying the predicates of their route too
+		match := ParseMatchCfg(r.Match).And(ParseMatchCfg(path.Match))
+		pathRoute = pathRoute.WithPattern(pathPattern).WithMatch(match).WithMiddlewareNames(append(
+			middlewareNames(r.MiddlewareGroup, r.Middleware, cfg),
+			middlewareNames(path.MiddlewareGroup, path.Middleware, cfg)...,
+		))
+
+		if usesCORS(r.MiddlewareGroup, r.Middleware, cfg) || usesCORS(path.MiddlewareGroup, path.Middleware, cfg) {
+			pathRoute = pathRoute.WithPreflight()
+		}
+
+		pathRoutes = append(pathRoutes, forMethods(pathRoute, path.Method, path.Methods)...)
 	}
 
 	return pathRoutes
@@ -160,22 +512,38 @@ func handlePathRoutes(r *config.RouteConfig, cfg *config.Config, resolvedRouteMi
 func (rr *RouteRegistry) ParseDomainRoutes(cfg *config.Config) {
 	var domainRoutes []route.DomainRoute
 
-	for _, r := range cfg.DomainRoutes {
+	for i, r := range cfg.DomainRoutes {
 		resolvedMiddleware := append(
-			resolveMiddlewareGroup(r.MiddlewareGroup, cfg),
-			resolveMiddlewareList(r.Middleware, cfg)...,
+			rr.resolveMiddlewareGroup(r.MiddlewareGroup, cfg),
+			rr.resolveMiddlewareList(r.Middleware, cfg)...,
 		)
 
 		domainPaths := make([]route.DomainPath, 0, len(r.Paths))
 		for _, path := range r.Paths {
-			resolvedPathMiddleware := resolveMiddlewareList(path.Middleware, cfg)
-			domainPath := route.NewDomainPath(path.Path, path.Method, resolvedPathMiddleware)
-			domainPaths = append(domainPaths, domainPath)
+			resolvedPathMiddleware := rr.resolveMiddlewareList(path.Middleware, cfg)
+			var pathPattern *pattern.Pattern
+			if pattern.IsPattern(path.Path) {
+				var err error
+				pathPattern, err = pattern.Compile(path.Path, false)
+				if err != nil {
+					log.Fatalf("[ERROR] Invalid path pattern '%s': %v", path.Path, err)
+				}
+			}
+
+			for _, method := range config.ExpandMethods(path.Method, path.Methods) {
+				domainPaths = append(domainPaths, route.NewDomainPath(path.Path, method, resolvedPathMiddleware).
+					WithRewrite(ParseRewriteCfg(path.Rewrite)).WithPattern(pathPattern).WithMiddlewareNames(path.Middleware))
+			}
 		}
 
 		domainRoutes = append(
 			domainRoutes,
-			route.NewDomainRoute(r.Domain, r.ProxyTarget, resolvedMiddleware).WithPaths(domainPaths),
+			route.NewDomainRoute(r.Domain, r.ProxyTarget, resolvedMiddleware).
+				WithMiddlewareNames(middlewareNames(r.MiddlewareGroup, r.Middleware, cfg)).
+				WithPaths(domainPaths).WithRewrite(ParseRewriteCfg(r.Rewrite)).WithMatch(ParseMatchCfg(r.Match)).
+				WithBalancer(rr.parseBalancer(domainBalancerName(i, r), r.Targets, r.Sticky, r.HealthCheck)).
+				WithWebSocket(ParseWebSocketCfg(r.Domain, r.WebSocket)).WithGRPCWeb(r.GRPCWeb).
+				WithListeners(r.Listeners),
 		)
 	}
 
@@ -184,10 +552,25 @@ func (rr *RouteRegistry) ParseDomainRoutes(cfg *config.Config) {
 
 func getRouteHandler(route route.Route) (gin.HandlerFunc, int8) {
 	switch {
-	case route.ProxyTarget != "":
-		//TODO: I think evaluation inside path.Clean method is wrong
+	case route.ProxyTarget != "" || route.Balancer != nil:
 		return func(c *gin.Context) {
-			handlers.ProxyRequestHandler(c, route.ProxyTarget, path.Clean(c.Param("path")+route.FixedPath))
+			targetPath := route.TargetPath(c.Request.URL.Path, c.Param("path"), c.Params)
+			proxy := func() {
+				route.WebSocket.Serve(c, func() {
+					handlers.ProxyRequestHandler(c, route.Target(c), targetPath)
+				})
+			}
+
+			serve := proxy
+			if route.Mirror != nil {
+				serve = func() { route.Mirror.Serve(c, targetPath, proxy) }
+			}
+
+			if route.GRPCWeb {
+				grpc.ServeWeb(c, serve)
+				return
+			}
+			serve()
 		}, RouteHandle
 
 	case route.RedirectTarget != "":
@@ -200,25 +583,322 @@ func getRouteHandler(route route.Route) (gin.HandlerFunc, int8) {
 	}
 }
 
+// routeParams carries the router and pattern parameters of a request to the
+// engine of the route serving it
+type routeParams struct{}
+
+// groupRoute is a route of a group together with the engine running its
+// middleware and handler
+type groupRoute struct {
+	pattern *pattern.Pattern
+	match   *route.Match
+	handler http.Handler
+}
+
+// routeGroup holds the routes registered under the same method and router
+// path, in the order they are defined
+type routeGroup struct {
+	routes []groupRoute
+}
+
+func (grp *routeGroup) add(p *pattern.Pattern, match *route.Match, handlerFuncs []gin.HandlerFunc, trustedProxies []string) {
+	grp.routes = append(grp.routes, groupRoute{
+		pattern: p,
+		match:   match,
+		handler: newGroupEngine(handlerFuncs, trustedProxies),
+	})
+}
+
+// newGroupEngine builds an engine running handlerFuncs for every request,
+// with the parameters of the route that matched it
+func newGroupEngine(handlerFuncs []gin.HandlerFunc, trustedProxies []string) *gin.Engine {
+	e := gin.New()
+	e.RedirectTrailingSlash = false
+	e.RedirectFixedPath = false
+	e.SetTrustedProxies(trustedProxies)
+
+	e.Use(func(c *gin.Context) {
+		c.Params, _ = c.Request.Context().Value(routeParams{}).(gin.Params)
+	})
+	e.Any("/*path", handlerFuncs...)
+
+	return e
+}
+
+// dispatch serves a request with the first route of the group whose pattern
+// matches its path and whose match predicates it satisfies. The named
+// parameters of the pattern come before the router ones.
+func (grp *routeGroup) dispatch(fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, gr := range grp.routes {
+			var named map[string]string
+			if gr.pattern != nil {
+				var ok bool
+				if named, ok = gr.pattern.Match(c.Request.URL.Path); !ok {
+					continue
+				}
+			}
+
+			if !gr.match.Matches(c.Request, c.ClientIP()) {
+				continue
+			}
+
+			params := make(gin.Params, 0, len(named)+len(c.Params))
+			if gr.pattern != nil {
+				for _, name := range gr.pattern.Names {
+					params = append(params, gin.Param{Key: name, Value: named[name]})
+				}
+			}
+			params = append(params, c.Params...)
+
+			ctx := context.WithValue(c.Request.Context(), routeParams{}, params)
+			handlers.ServeNested(c, gr.handler, c.Request.WithContext(ctx))
+			return
+		}
+
+		fallback(c)
+	}
+}
+
+// notFound serves requests of route groups when none of the routes matched,
+// the same way as requests matching no route at all
+func (rr *RouteRegistry) notFound(c *gin.Context) {
+	if len(rr.domainHandlers) != 0 {
+		handlers.DomainProxyHandler(c, rr.domainHandlers)
+		return
+	}
+	c.String(http.StatusNotFound, "404 page not found")
+}
+
 func (rr *RouteRegistry) RegisterRoutes(r *gin.Engine) {
+	type registration struct {
+		method       string
+		relativePath string
+		route        route.Route
+		handlerFuncs []gin.HandlerFunc
+	}
+
+	var registrations []registration
+	preflightPaths := make(map[string]bool)
+	// Paths are dispatched by the registry when one of their routes has a
+	// pattern or match predicates, others are left to the router alone
+	dispatched := make(map[string]bool)
+
+	// Routes sharing a path with different methods register OPTIONS once,
+	// routes that are told apart by pattern or predicates each register it
+	preflightKey := func(route route.Route) string {
+		if route.Pattern != nil {
+			return route.Pattern.Raw
+		}
+		return route.RelativePath
+	}
+
+	// Routes registered for OPTIONS themselves answer preflight requests
 	for _, route := range rr.Routes {
-		handler, routeType := getRouteHandler(route)
+		if route.Method == http.MethodOptions {
+			preflightPaths[preflightKey(route)] = true
+		}
+	}
 
-		switch routeType {
-		case RouteHandle:
-			handlerFuncs := append(route.Middleware, handler)
-			r.Handle(route.Method, route.RelativePath, handlerFuncs...)
-		case RouteInvalidRoute:
+	for _, route := range rr.Routes {
+		handler, routeType := getRouteHandler(route)
+		if routeType == RouteInvalidRoute {
 			log.Fatal("[ERROR] Invalid/Unknown route configuration")
 		}
+		handlerFuncs := append(route.Middleware, handler)
+
+		// Unlike literal paths, proxied patterns also match without a trailing
+		// slash instead of being redirected
+		relativePaths := []string{route.RelativePath}
+		if exactPath, ok := strings.CutSuffix(route.RelativePath, "/*path"); ok && route.Pattern != nil {
+			relativePaths = append(relativePaths, exactPath)
+		}
+
+		key := preflightKey(route)
+		preflight := route.Preflight && route.Method != http.MethodOptions && (route.Match != nil || !preflightPaths[key])
+		preflightPaths[key] = preflightPaths[key] || route.Preflight
+
+		for _, relativePath := range relativePaths {
+			methods := []string{route.Method}
+			if preflight {
+				methods = append(methods, http.MethodOptions)
+			}
+
+			for _, method := range methods {
+				registrations = append(registrations, registration{method, relativePath, route, handlerFuncs})
+				if route.Pattern != nil || route.Match != nil {
+					dispatched[method+" "+relativePath] = true
+				}
+			}
+		}
+	}
+
+	groups := make(map[string]*routeGroup)
+	for _, reg := range registrations {
+		key := reg.method + " " + reg.relativePath
+		if !dispatched[key] {
+			r.Handle(reg.method, reg.relativePath, reg.handlerFuncs...)
+			continue
+		}
+
+		grp, ok := groups[key]
+		if !ok {
+			grp = &routeGroup{}
+			groups[key] = grp
+			r.Handle(reg.method, reg.relativePath, grp.dispatch(rr.notFound))
+		}
+		grp.add(reg.route.Pattern, reg.route.Match, reg.handlerFuncs, rr.TrustedProxies)
+	}
+}
+
+// newDomainHandler builds the engine serving a single domain. Requests
+// matching one of its paths by method and exact path run the path middleware
+// after the domain middleware, everything else only the domain middleware.
+// The domain middleware runs in the chain of the engine rather than being
+// called one by one, so middleware wrapping the proxy with c.Next(), like the
+// response cache, sees its response.
+func newDomainHandler(dr route.DomainRoute, trustedProxies []string) *gin.Engine {
+	e := gin.New()
+	e.RedirectTrailingSlash = false
+	e.RedirectFixedPath = false
+	e.SetTrustedProxies(trustedProxies)
+
+	proxy := func(rewrite *route.Rewrite) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			proxy := func() {
+				dr.WebSocket.Serve(c, func() {
+					handlers.ProxyRequestHandler(c, dr.Target(c), route.CleanPath(rewrite.Apply(c.Request.URL.Path, c.Params)))
+				})
+			}
+
+			if dr.GRPCWeb {
+				grpc.ServeWeb(c, proxy)
+				return
+			}
+			proxy()
+		}
+	}
+
+	// Literal paths are compared as they are instead of being handed to the
+	// router, where ':' and '*' would be wildcards and paths defined twice
+	// would conflict. The middleware of every path defined for the same method
+	// and path runs, in the order the paths are defined.
+	type literalPath struct {
+		rewrite    *route.Rewrite
+		middleware []gin.HandlerFunc
+	}
+	literalPaths := make(map[string]*literalPath)
+	for _, p := range dr.Paths {
+		if p.Pattern != nil {
+			continue
+		}
+
+		key := p.Method + " " + p.Path
+		lp, ok := literalPaths[key]
+		if !ok {
+			lp = &literalPath{rewrite: p.Rewrite}
+			if lp.rewrite == nil {
+				lp.rewrite = dr.Rewrite
+			}
+			literalPaths[key] = lp
+		}
+		lp.middleware = append(lp.middleware, p.Middleware...)
+	}
+
+	literals := make(map[string]http.Handler, len(literalPaths))
+	for key, lp := range literalPaths {
+		literals[key] = newGroupEngine(append(lp.middleware, proxy(lp.rewrite)), trustedProxies)
+	}
+
+	// Literal paths win over patterns, whichever route of the router the
+	// request ends up in
+	literal := func(next gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if handler, ok := literals[c.Request.Method+" "+c.Request.URL.Path]; ok {
+				handlers.ServeNested(c, handler, c.Request)
+				return
+			}
+			next(c)
+		}
 	}
+
+	e.Use(dr.Middleware...)
+	groups := make(map[string]*routeGroup)
+	for _, p := range dr.Paths {
+		if p.Pattern == nil {
+			continue
+		}
+
+		rewrite := p.Rewrite
+		if rewrite == nil {
+			rewrite = dr.Rewrite
+		}
+		handlerFuncs := append(append([]gin.HandlerFunc{}, p.Middleware...), proxy(rewrite))
+
+		// Requests matching none of the patterns only run the domain middleware
+		key := p.Method + " " + p.Pattern.RouterPath
+		grp, ok := groups[key]
+		if !ok {
+			grp = &routeGroup{}
+			groups[key] = grp
+			e.Handle(p.Method, p.Pattern.RouterPath, literal(grp.dispatch(proxy(dr.Rewrite))))
+		}
+		grp.add(p.Pattern, nil, handlerFuncs, trustedProxies)
+	}
+	e.NoRoute(literal(proxy(dr.Rewrite)))
+
+	return e
+}
+
+// newDomainDispatcher builds the engine serving a domain with several routes,
+// requests are served by the first route whose match predicates they satisfy
+func newDomainDispatcher(routes []route.DomainRoute, trustedProxies []string) *gin.Engine {
+	e := gin.New()
+	e.SetTrustedProxies(trustedProxies)
+
+	grp := &routeGroup{}
+	for _, dr := range routes {
+		grp.routes = append(grp.routes, groupRoute{
+			match:   dr.Match,
+			handler: newDomainHandler(dr, trustedProxies),
+		})
+	}
+
+	e.NoRoute(func(c *gin.Context) {
+		for _, gr := range grp.routes {
+			if gr.match.Matches(c.Request, c.ClientIP()) {
+				handlers.ServeNested(c, gr.handler, c.Request)
+				return
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "no backend found for domain"})
+	})
+
+	return e
 }
 
 func (rr *RouteRegistry) RegisterDomainRoutes(r *gin.Engine) {
 	if len(rr.DomainRoutes) == 0 {
 		return
 	}
+
+	domainRoutes := make(map[string][]route.DomainRoute)
+	for _, dr := range rr.DomainRoutes {
+		domainRoutes[dr.Domain] = append(domainRoutes[dr.Domain], dr)
+	}
+
+	domainHandlers := make(map[string]http.Handler)
+	for domain, routes := range domainRoutes {
+		// Without predicates the first route defined for a domain wins
+		if routes[0].Match == nil {
+			domainHandlers[domain] = newDomainHandler(routes[0], rr.TrustedProxies)
+			continue
+		}
+		domainHandlers[domain] = newDomainDispatcher(routes, rr.TrustedProxies)
+	}
+	rr.domainHandlers = domainHandlers
+
 	r.NoRoute(func(c *gin.Context) {
-		handlers.DomainProxyHandler(c, rr.DomainRoutes)
+		handlers.DomainProxyHandler(c, domainHandlers)
 	})
 }
@@ -1,9 +1,33 @@
 package registry
 
 import (
+	"bufio"
+	"bytes"
 	"cloud_gateway/config"
+	"cloud_gateway/grpc"
+	"cloud_gateway/metrics"
+	"cloud_gateway/ratelimit"
 	"cloud_gateway/route"
+	"cloud_gateway/upstream"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func RoutesAreEqual(expected, actual route.Route) bool {
@@ -130,3 +154,1162 @@ func TestMiddlewareParsing(t *testing.T) {
 
 	}
 }
+
+func TestPreflightRegistration(t *testing.T) {
+	cfg := &config.Config{
+		CORS: map[string]*config.CORSConfig{
+			"cors_1": {AllowOrigins: []string{"https://app.com"}, AllowMethods: []string{"GET", "POST"}},
+		},
+		Routes: []*config.RouteConfig{
+			{
+				Prefix: "/api",
+				Paths: []*config.PathConfig{
+					{Path: "/items", Method: "GET", ProxyTarget: "https://bar.com", Middleware: []string{"cors_1"}},
+					{Path: "/items", Method: "POST", ProxyTarget: "https://bar.com", Middleware: []string{"cors_1"}},
+					{Path: "/private", Method: "GET", ProxyTarget: "https://bar.com"},
+				},
+			},
+		},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+
+	registered := make(map[string]bool)
+	for _, info := range r.Routes() {
+		registered[info.Method+" "+info.Path] = true
+	}
+
+	if !registered["OPTIONS /api/items/*path"] {
+		t.Error("Expected OPTIONS to be registered for route with cors middleware")
+	}
+
+	if registered["OPTIONS /api/private/*path"] {
+		t.Error("OPTIONS should not be registered for route without cors middleware")
+	}
+}
+
+func TestRewriteRouting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name     string
+		route    *config.RouteConfig
+		request  string
+		expected string
+	}{
+		{
+			name:     "prefix dropped by default",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL},
+			request:  "/api/users?page=2",
+			expected: "/users?page=2",
+		},
+		{
+			name:     "trailing slash kept",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL},
+			request:  "/api/users/",
+			expected: "/users/",
+		},
+		{
+			name: "fixed path before wildcard",
+			route: &config.RouteConfig{Prefix: "/api", Paths: []*config.PathConfig{
+				{Path: "/v1", Method: "GET", ProxyTarget: upstream.URL},
+			}},
+			request:  "/api/v1/items",
+			expected: "/v1/items",
+		},
+		{
+			name: "fixed path requested exactly",
+			route: &config.RouteConfig{Prefix: "/api", Paths: []*config.PathConfig{
+				{Path: "/empty", Method: "GET", ProxyTarget: upstream.URL},
+			}},
+			request:  "/api/empty",
+			expected: "/empty",
+		},
+		{
+			name: "fixed path requested with trailing slash",
+			route: &config.RouteConfig{Prefix: "/api", Paths: []*config.PathConfig{
+				{Path: "/empty", Method: "GET", ProxyTarget: upstream.URL},
+			}},
+			request:  "/api/empty/",
+			expected: "/empty",
+		},
+		{
+			name: "trailing slash kept below fixed path",
+			route: &config.RouteConfig{Prefix: "/api", Paths: []*config.PathConfig{
+				{Path: "/v1", Method: "GET", ProxyTarget: upstream.URL},
+			}},
+			request:  "/api/v1/items/",
+			expected: "/v1/items/",
+		},
+		{
+			name:     "prefix preserved",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{PreservePrefix: true}},
+			request:  "/api/users",
+			expected: "/api/users",
+		},
+		{
+			name:     "strip prefix",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{StripPrefix: "/v1"}},
+			request:  "/api/v1/users",
+			expected: "/users",
+		},
+		{
+			name:     "strip prefix of whole segments only",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{StripPrefix: "/v1"}},
+			request:  "/api/v10/users",
+			expected: "/v10/users",
+		},
+		{
+			name:     "add prefix",
+			route:    &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{AddPrefix: "/internal/"}},
+			request:  "/api/users?active=true",
+			expected: "/internal/users?active=true",
+		},
+		{
+			name: "regex replace with capture groups",
+			route: &config.RouteConfig{Prefix: "/api", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{
+				Regex:       "^/users/([0-9]+)/posts$",
+				Replacement: "/accounts/$1/articles",
+			}},
+			request:  "/api/users/42/posts?limit=5",
+			expected: "/accounts/42/articles?limit=5",
+		},
+		{
+			name: "path inherits route rewrite",
+			route: &config.RouteConfig{Prefix: "/api", Rewrite: &config.RewriteConfig{AddPrefix: "/internal"}, Paths: []*config.PathConfig{
+				{Path: "/v1", Method: "GET", ProxyTarget: upstream.URL},
+			}},
+			request:  "/api/v1/items",
+			expected: "/internal/v1/items",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := &RouteRegistry{}
+			rr.FromConfig(&config.Config{Routes: []*config.RouteConfig{tc.route}})
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			rr.RegisterRoutes(r)
+			gateway := httptest.NewServer(r)
+			defer gateway.Close()
+
+			resp, err := http.Get(gateway.URL + tc.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tc.expected {
+				t.Errorf("Expected upstream request %q, got %q", tc.expected, string(body))
+			}
+		})
+	}
+}
+
+func TestPatternRouting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI() + " " + r.Header.Get("X-User-Id")))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Headers: map[string]*config.HeadersConfig{
+			"user-header": {Request: config.HeaderRulesConfig{Set: map[string]string{"X-User-Id": "{param.id}"}}},
+		},
+		Routes: []*config.RouteConfig{{
+			Prefix: "/api",
+			Paths: []*config.PathConfig{
+				{Path: "/users/{id:[0-9]+}", Method: "GET", ProxyTarget: upstream.URL, Middleware: []string{"user-header"}, Rewrite: &config.RewriteConfig{
+					Regex:       "^/users/[0-9]+",
+					Replacement: "/accounts/{param.id}",
+				}},
+				{Path: "/users/{name}", Method: "GET", ProxyTarget: upstream.URL, Rewrite: &config.RewriteConfig{AddPrefix: "/by-name/{param.name}"}},
+				{Path: "/files/*.json", Method: "GET", ProxyTarget: upstream.URL},
+				{Path: "/static/**", Method: "GET", ProxyTarget: upstream.URL},
+			},
+		}},
+		DomainRoutes: []*config.DomainRouteConfig{{
+			Domain:      "example.com",
+			ProxyTarget: upstream.URL,
+			Paths: []*config.DomainPathConfig{
+				{Path: "/orders/{id:[0-9]+}", Method: "GET", Middleware: []string{"user-header"}},
+			},
+		}},
+	}
+
+	testCases := []struct {
+		name           string
+		host           string
+		request        string
+		expectedStatus int
+		expected       string
+	}{
+		{name: "constrained parameter", request: "/api/users/42/posts", expectedStatus: http.StatusOK, expected: "/accounts/42/posts 42"},
+		{name: "next pattern of the same shape", request: "/api/users/me", expectedStatus: http.StatusOK, expected: "/by-name/me/users/me "},
+		{name: "glob", request: "/api/files/data.json", expectedStatus: http.StatusOK, expected: "/files/data.json "},
+		{name: "glob not matching", request: "/api/files/data.xml", expectedStatus: http.StatusNotFound},
+		{name: "catch all", request: "/api/static/css/site.css", expectedStatus: http.StatusOK, expected: "/static/css/site.css "},
+		{name: "domain path pattern", host: "example.com", request: "/orders/7", expectedStatus: http.StatusOK, expected: "/orders/7 7"},
+		{name: "domain path pattern not matching", host: "example.com", request: "/orders/latest", expectedStatus: http.StatusOK, expected: "/orders/latest "},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+tc.request, nil)
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tc.expectedStatus == http.StatusOK && string(body) != tc.expected {
+				t.Errorf("Expected upstream request %q, got %q", tc.expected, string(body))
+			}
+		})
+	}
+}
+
+func TestMatchRouting(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	stable, canary, v2, internal := newUpstream("stable"), newUpstream("canary"), newUpstream("v2"), newUpstream("internal")
+	defer stable.Close()
+	defer canary.Close()
+	defer v2.Close()
+	defer internal.Close()
+
+	cfg := &config.Config{
+		Routes: []*config.RouteConfig{
+			{Prefix: "/api", Method: "GET", ProxyTarget: canary.URL, Match: &config.MatchConfig{
+				Headers: []*config.MatchRuleConfig{{Name: "X-Canary", Equals: "true"}},
+			}},
+			{Prefix: "/api", Method: "GET", ProxyTarget: canary.URL, Match: &config.MatchConfig{
+				Cookies: []*config.MatchRuleConfig{{Name: "group", Regex: "^beta-"}},
+			}},
+			{Prefix: "/api", Method: "GET", ProxyTarget: v2.URL, Match: &config.MatchConfig{
+				Query: []*config.MatchRuleConfig{{Name: "version", Equals: "2"}},
+			}},
+			{Prefix: "/api", Method: "GET", ProxyTarget: internal.URL, Match: &config.MatchConfig{
+				ClientCIDRs: []string{"10.0.0.0/8"},
+			}},
+			{Prefix: "/api", Method: "GET", ProxyTarget: stable.URL},
+			{Prefix: "/shop", Match: &config.MatchConfig{Headers: []*config.MatchRuleConfig{{Name: "X-Canary"}}}, Paths: []*config.PathConfig{
+				{Path: "/items", Method: "GET", ProxyTarget: v2.URL, Match: &config.MatchConfig{
+					Query: []*config.MatchRuleConfig{{Name: "version", Equals: "2"}},
+				}},
+			}},
+			{Prefix: "/shop", Paths: []*config.PathConfig{
+				{Path: "/items", Method: "GET", ProxyTarget: stable.URL},
+			}},
+		},
+		DomainRoutes: []*config.DomainRouteConfig{
+			{Domain: "example.com", ProxyTarget: canary.URL, Match: &config.MatchConfig{
+				Query: []*config.MatchRuleConfig{{Name: "preview"}},
+			}},
+			{Domain: "example.com", ProxyTarget: stable.URL},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		request  string
+		header   http.Header
+		expected string
+	}{
+		{name: "no predicate matching", request: "/api/users", expected: "stable"},
+		{name: "header equals", request: "/api/users", header: http.Header{"X-Canary": {"true"}}, expected: "canary"},
+		{name: "header not equal", request: "/api/users", header: http.Header{"X-Canary": {"false"}}, expected: "stable"},
+		{name: "cookie regex", request: "/api/users", header: http.Header{"Cookie": {"group=beta-7"}}, expected: "canary"},
+		{name: "query param equals", request: "/api/users?version=2", expected: "v2"},
+		{name: "path and route predicates", request: "/shop/items/?version=2", header: http.Header{"X-Canary": {"1"}}, expected: "v2"},
+		{name: "path predicate without route predicate", request: "/shop/items/?version=2", expected: "stable"},
+		{name: "client cidr", request: "/api/users", header: http.Header{"X-Forwarded-For": {"10.1.2.3"}}, expected: "internal"},
+		{name: "client cidr not matching", request: "/api/users", header: http.Header{"X-Forwarded-For": {"192.168.1.1"}}, expected: "stable"},
+		{name: "domain query param present", host: "example.com", request: "/page?preview", expected: "canary"},
+		{name: "domain fallback route", host: "example.com", request: "/page", expected: "stable"},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+	rr.TrustedProxies = []string{"127.0.0.1"}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(rr.TrustedProxies)
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+tc.request, nil)
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tc.expected {
+				t.Errorf("Expected the request to reach %q, got %q", tc.expected, string(body))
+			}
+		})
+	}
+}
+
+func TestWeightedRouting(t *testing.T) {
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("v1")) }))
+	v2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("v2")) }))
+	defer v1.Close()
+	defer v2.Close()
+
+	cfg := &config.Config{Routes: []*config.RouteConfig{{
+		Prefix: "/weighted",
+		Method: "GET",
+		Targets: []*config.WeightedTargetConfig{
+			{URL: v1.URL, Weight: 1},
+			{URL: v2.URL, Weight: 0},
+		},
+		Sticky: &config.StickyConfig{Header: "X-User-Id"},
+	}}}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	get := func() string {
+		req, _ := http.NewRequest("GET", gateway.URL+"/weighted/items", nil)
+		req.Header.Set("X-User-Id", "42")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if target := get(); target != "v1" {
+		t.Fatalf("Expected all requests on v1, got %s", target)
+	}
+
+	// Reloading the weights moves traffic without registering routes again
+	cfg.Routes[0].Targets = []*config.WeightedTargetConfig{
+		{URL: v1.URL, Weight: 0},
+		{URL: v2.URL, Weight: 1},
+	}
+	ReloadTargets(cfg)
+
+	if target := get(); target != "v2" {
+		t.Fatalf("Expected all requests on v2 after the reload, got %s", target)
+	}
+}
+
+func TestBalancerReparse(t *testing.T) {
+	var probes atomic.Int32
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			probes.Add(1)
+		}
+		w.Write([]byte("v1"))
+	}))
+	v2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("v2")) }))
+	defer v1.Close()
+	defer v2.Close()
+
+	newCfg := func(target string, sticky *config.StickyConfig) *config.Config {
+		return &config.Config{Routes: []*config.RouteConfig{{
+			Prefix:  "/reparsed",
+			Method:  "GET",
+			Targets: []*config.WeightedTargetConfig{{URL: target, Weight: 1}},
+			Sticky:  sticky,
+			HealthCheck: &config.HealthCheckConfig{
+				Path:               "/healthz",
+				Interval:           5 * time.Millisecond,
+				Timeout:            time.Second,
+				UnhealthyThreshold: 1,
+				HealthyThreshold:   1,
+			},
+		}}}
+	}
+
+	first := &RouteRegistry{}
+	first.FromConfig(newCfg(v1.URL, nil))
+	second := &RouteRegistry{}
+	second.FromConfig(newCfg(v2.URL, &config.StickyConfig{Header: "X-User-Id"}))
+
+	b := second.Routes[0].Balancer
+	if b == first.Routes[0].Balancer {
+		t.Fatal("Expected a new balancer for the parsed config")
+	}
+	if targets := b.Targets(); len(targets) != 1 || targets[0].URL != v2.URL {
+		t.Errorf("Expected the targets of the parsed config, got %v", targets)
+	}
+	if second.Balancers["routes[0] /reparsed"] != b {
+		t.Errorf("Expected the registry to hold the balancer of the route")
+	}
+
+	// Reloads of the targets find the balancer of the latest parse
+	if registered, ok := upstream.Lookup("routes[0] /reparsed"); !ok || registered != b {
+		t.Errorf("Expected reloads to find the balancer of the latest parse")
+	}
+
+	// The health checks of the replaced balancer are stopped
+	time.Sleep(20 * time.Millisecond)
+	stopped := probes.Load()
+	time.Sleep(50 * time.Millisecond)
+	if actual := probes.Load(); actual != stopped {
+		t.Errorf("Expected the replaced balancer to stop probing, got %d more probes", actual-stopped)
+	}
+}
+
+func TestRateLimiterReparse(t *testing.T) {
+	cfg := &config.Config{
+		RateLimiters: map[string]*config.RateLimitConfig{
+			"fw_1": {
+				Algorithm:       "fixed_window_counter",
+				Limit:           10,
+				WindowSize:      time.Minute,
+				Ttl:             time.Minute,
+				CleanupInterval: time.Minute,
+			},
+		},
+		Routes: []*config.RouteConfig{
+			{Prefix: "/a", Method: "GET", ProxyTarget: "http://localhost", Middleware: []string{"fw_1"}},
+			{Prefix: "/b", Method: "GET", ProxyTarget: "http://localhost", Middleware: []string{"fw_1"}},
+		},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+	rr.RateLimiters["fw_1"][0].(*ratelimit.Store).Allow("192.0.2.1")
+	rr.FromConfig(cfg)
+
+	if limiters := rr.RateLimiters["fw_1"]; len(limiters) != 2 {
+		t.Errorf("Expected the 2 limiters of the latest parse, got %d", len(limiters))
+	}
+	if counts := ratelimit.KeyCounts(rr.RateLimiters); counts["fw_1"] != 0 {
+		t.Errorf("Expected no keys tracked by the limiters of the latest parse, got %d", counts["fw_1"])
+	}
+}
+
+// newEchoServer upgrades every request and echoes the lines sent over the
+// upgraded connection, prefixed with the path of the upgrade request
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			brw.WriteString(r.URL.Path + " " + line)
+			brw.Flush()
+		}
+	}))
+}
+
+// dialWebSocket sends an upgrade request through the gateway and returns the
+// connection with the status of the response
+func dialWebSocket(t *testing.T, addr, host, path string) (net.Conn, *bufio.Reader, int) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path, host)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+	}
+	return conn, br, resp.StatusCode
+}
+
+func TestWebSocketRouting(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Routes: []*config.RouteConfig{{
+			Prefix:      "/ws",
+			Method:      "GET",
+			ProxyTarget: backend.URL,
+			WebSocket:   &config.WebSocketConfig{MaxConnections: 1, IdleTimeout: 200 * time.Millisecond},
+		}},
+		DomainRoutes: []*config.DomainRouteConfig{{
+			Domain:      "ws.example.com",
+			ProxyTarget: backend.URL,
+			WebSocket:   &config.WebSocketConfig{MaxLifetime: 200 * time.Millisecond},
+		}},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+	addr := strings.TrimPrefix(gateway.URL, "http://")
+
+	echo := func(conn net.Conn, br *bufio.Reader, expected string) {
+		fmt.Fprint(conn, "ping\n")
+		line, err := br.ReadString('\n')
+		if err != nil || line != expected {
+			t.Fatalf("Expected the echo %q, got %q (%v)", expected, line, err)
+		}
+	}
+	waitClosed := func(conn net.Conn, br *bufio.Reader) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := br.ReadByte(); err != io.EOF {
+			t.Fatalf("Expected the gateway to close the connection, got %v", err)
+		}
+	}
+
+	conn, br, status := dialWebSocket(t, addr, "localhost", "/ws/chat")
+	defer conn.Close()
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the upgrade to succeed, got %d", status)
+	}
+	echo(conn, br, "/chat ping\n")
+	if open := metrics.Value("gateway_websocket_connections", "route", "/ws"); open != 1 {
+		t.Errorf("Expected 1 open connection, got %d", open)
+	}
+
+	// The route allows a single connection
+	second, _, status := dialWebSocket(t, addr, "localhost", "/ws/chat")
+	second.Close()
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the second connection to be rejected, got %d", status)
+	}
+
+	// Traffic keeps the connection open past the idle timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		echo(conn, br, "/chat ping\n")
+	}
+	waitClosed(conn, br)
+
+	deadline := time.Now().Add(time.Second)
+	for metrics.Value("gateway_websocket_connections", "route", "/ws") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the closed connection to no longer be counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A connection of a domain route is closed at its max lifetime even while in use
+	conn, br, status = dialWebSocket(t, addr, "ws.example.com", "/feed")
+	defer conn.Close()
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the upgrade to succeed on the domain route, got %d", status)
+	}
+	echo(conn, br, "/feed ping\n")
+	waitClosed(conn, br)
+}
+
+func TestMethodRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		CORS: map[string]*config.CORSConfig{
+			"cors_1": {AllowOrigins: []string{"https://app.com"}, AllowMethods: []string{"GET", "POST"}},
+		},
+		Routes: []*config.RouteConfig{
+			{Prefix: "/items", Methods: []string{"GET", "POST", "PUT"}, ProxyTarget: backend.URL},
+			{Prefix: "/any", Method: config.MethodAny, ProxyTarget: backend.URL, Middleware: []string{"cors_1"}},
+			{
+				Prefix: "/api",
+				Paths: []*config.PathConfig{
+					{Path: "/users", Methods: []string{"HEAD", "DELETE"}, ProxyTarget: backend.URL},
+				},
+			},
+		},
+		DomainRoutes: []*config.DomainRouteConfig{{
+			Domain:      "example.com",
+			ProxyTarget: backend.URL,
+			Paths:       []*config.DomainPathConfig{{Path: "/status", Methods: []string{"GET", "HEAD"}}},
+		}},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	testCases := []struct {
+		method         string
+		host           string
+		path           string
+		expectedStatus int
+	}{
+		{method: "GET", path: "/items/1", expectedStatus: http.StatusOK},
+		{method: "PUT", path: "/items/1", expectedStatus: http.StatusOK},
+		{method: "DELETE", path: "/items/1", expectedStatus: http.StatusNotFound},
+		{method: "HEAD", path: "/any/x", expectedStatus: http.StatusOK},
+		{method: "TRACE", path: "/any/x", expectedStatus: http.StatusOK},
+		{method: "OPTIONS", path: "/any/x", expectedStatus: http.StatusOK},
+		{method: "HEAD", path: "/api/users/1", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/api/users/1", expectedStatus: http.StatusNotFound},
+		{method: "HEAD", host: "example.com", path: "/status", expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.host+tc.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, gateway.URL+tc.path, nil)
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedStatus == http.StatusOK && resp.Header.Get("X-Method") != tc.method {
+				t.Errorf("Expected the upstream to receive %s, got %s", tc.method, resp.Header.Get("X-Method"))
+			}
+		})
+	}
+}
+
+func TestGRPCRouting(t *testing.T) {
+	// The upstream echoes every message of the stream as it arrives and ends
+	// the call with its status in the trailers
+	backend := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				http.NewResponseController(w).Flush()
+			}
+			if err != nil {
+				break
+			}
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}), &http2.Server{}))
+	backend.Start()
+	defer backend.Close()
+
+	cfg := &config.Config{
+		RateLimiters: map[string]*config.RateLimitConfig{
+			"fw_1": {
+				Algorithm:       "fixed_window_counter",
+				Limit:           1,
+				WindowSize:      time.Minute,
+				Ttl:             time.Minute,
+				CleanupInterval: time.Minute,
+				RejectStatus:    http.StatusTooManyRequests,
+				RejectBody:      `{"error":"rate limit exceeded"}`,
+			},
+		},
+		Routes: []*config.RouteConfig{{
+			Prefix:      "/echo.Echo",
+			Method:      "POST",
+			ProxyTarget: backend.URL,
+			Middleware:  []string{"fw_1"},
+		}},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.UseH2C = true
+	rr.RegisterRoutes(r)
+	gateway := httptest.NewServer(r.Handler())
+	defer gateway.Close()
+
+	gatewayURL, _ := url.Parse(gateway.URL)
+	client := &http.Client{Transport: grpc.Transport(gatewayURL)}
+
+	body, stream := io.Pipe()
+	req, _ := http.NewRequest("POST", gateway.URL+"/echo.Echo/Stream", body)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	// Both directions of the stream stay open at once
+	go stream.Write([]byte("first"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("Expected HTTP/2 between client and gateway, got %s", resp.Proto)
+	}
+
+	read := func(expected string) {
+		buf := make([]byte, len(expected))
+		if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != expected {
+			t.Fatalf("Expected the message %q, got %q (%v)", expected, buf, err)
+		}
+	}
+	read("first")
+	stream.Write([]byte("second"))
+	read("second")
+	stream.Close()
+
+	if rest, _ := io.ReadAll(resp.Body); len(rest) != 0 {
+		t.Fatalf("Expected no more messages, got %q", rest)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" || resp.Trailer.Get("Grpc-Message") != "done" {
+		t.Errorf("Expected the trailers of the upstream, got %v", resp.Trailer)
+	}
+
+	// The rate limiter rejects the next call with a gRPC status instead of JSON
+	req, _ = http.NewRequest("POST", gateway.URL+"/echo.Echo/Stream", strings.NewReader("third"))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != strconv.Itoa(grpc.CodeResourceExhausted) {
+		t.Errorf("Expected a gRPC resource exhausted status, got %d with grpc-status %q", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+	if len(rejected) != 0 {
+		t.Errorf("Expected a trailers-only response, got body %q", rejected)
+	}
+}
+
+func grpcFrame(flag byte, payload string) []byte {
+	frame := []byte{flag, 0, 0, 0, byte(len(payload))}
+	return append(frame, payload...)
+}
+
+func TestGRPCWebRouting(t *testing.T) {
+	backend := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		contentType := r.Header.Get("Content-Type")
+		if r.ProtoMajor != 2 || !strings.HasPrefix(contentType, "application/grpc") || r.Header.Get("Te") != "trailers" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}), &http2.Server{}))
+	backend.Start()
+	defer backend.Close()
+
+	cfg := &config.Config{
+		CORS: map[string]*config.CORSConfig{
+			"cors_1": {AllowOrigins: []string{"https://app.com"}, AllowMethods: []string{"POST"}, AllowHeaders: []string{"Content-Type"}},
+		},
+		Routes: []*config.RouteConfig{{
+			Prefix:      "/echo.Echo",
+			Method:      "POST",
+			ProxyTarget: backend.URL,
+			Middleware:  []string{"cors_1"},
+			GRPCWeb:     true,
+		}},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	message := grpcFrame(0, "hello")
+	expected := string(message) + string(grpcFrame(0x80, "grpc-message: done\r\ngrpc-status: 0\r\n"))
+
+	call := func(contentType string, body io.Reader) (*http.Response, string) {
+		req, _ := http.NewRequest("POST", gateway.URL+"/echo.Echo/Say", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		req.Header.Set("Origin", "https://app.com")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp, string(respBody)
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		resp, body := call("application/grpc-web+proto", bytes.NewReader(message))
+		if resp.Header.Get("Content-Type") != "application/grpc-web+proto" {
+			t.Errorf("Expected a gRPC-Web response, got %q", resp.Header.Get("Content-Type"))
+		}
+		if body != expected {
+			t.Errorf("Expected the message and the trailer frame, got %q", body)
+		}
+		if expose := resp.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(expose, "Grpc-Status") {
+			t.Errorf("Expected the grpc status to be exposed to the browser, got %q", expose)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		// The body is sent as two separately padded chunks
+		encoded := base64.StdEncoding.EncodeToString(message[:3]) + base64.StdEncoding.EncodeToString(message[3:])
+		resp, body := call("application/grpc-web-text", strings.NewReader(encoded))
+		if resp.Header.Get("Content-Type") != "application/grpc-web-text" {
+			t.Errorf("Expected a gRPC-Web text response, got %q", resp.Header.Get("Content-Type"))
+		}
+
+		var decoded []byte
+		for i := 0; i+4 <= len(body); i += 4 {
+			group, err := base64.StdEncoding.DecodeString(body[i : i+4])
+			if err != nil {
+				t.Fatalf("Expected a base64 body, got %q", body)
+			}
+			decoded = append(decoded, group...)
+		}
+		if string(decoded) != expected {
+			t.Errorf("Expected the message and the trailer frame, got %q", decoded)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		req, _ := http.NewRequest("OPTIONS", gateway.URL+"/echo.Echo/Say", nil)
+		req.Header.Set("Origin", "https://app.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if allow := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(allow, "X-Grpc-Web") || !strings.Contains(allow, "X-User-Agent") {
+			t.Errorf("Expected the gRPC-Web headers to be allowed, got %q", allow)
+		}
+	})
+}
+
+func TestListenerRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Routes: []*config.RouteConfig{
+			{Prefix: "/public", Method: "GET", ProxyTarget: backend.URL},
+			{Prefix: "/internal", Method: "GET", ProxyTarget: backend.URL + "/internal", Listeners: []string{"internal"}},
+			// The same path on another listener does not conflict
+			{Prefix: "/internal", Method: "GET", ProxyTarget: backend.URL + "/admin", Listeners: []string{"admin"}},
+			{Prefix: "/health", Method: "GET", ProxyTarget: backend.URL, Listeners: []string{config.DefaultListener, "internal"}},
+		},
+		DomainRoutes: []*config.DomainRouteConfig{
+			{Domain: "internal.example.com", ProxyTarget: backend.URL + "/domain", Listeners: []string{"internal"}},
+		},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	listeners := make(map[string]*httptest.Server)
+	for _, name := range []string{config.DefaultListener, "internal", "admin"} {
+		r := gin.New()
+		listenerRR := rr.ForListener(name)
+		listenerRR.RegisterRoutes(r)
+		listenerRR.RegisterDomainRoutes(r)
+		listeners[name] = httptest.NewServer(r)
+		defer listeners[name].Close()
+	}
+
+	testCases := []struct {
+		listener       string
+		host           string
+		path           string
+		expectedStatus int
+		expectedPath   string
+	}{
+		{listener: config.DefaultListener, path: "/public/x", expectedStatus: http.StatusOK, expectedPath: "/x"},
+		{listener: config.DefaultListener, path: "/internal/x", expectedStatus: http.StatusNotFound},
+		{listener: config.DefaultListener, path: "/health", expectedStatus: http.StatusOK, expectedPath: "/"},
+		{listener: config.DefaultListener, host: "internal.example.com", path: "/x", expectedStatus: http.StatusNotFound},
+		{listener: "internal", path: "/public/x", expectedStatus: http.StatusNotFound},
+		{listener: "internal", path: "/internal/x", expectedStatus: http.StatusOK, expectedPath: "/internal/x"},
+		{listener: "internal", path: "/health", expectedStatus: http.StatusOK, expectedPath: "/"},
+		{listener: "internal", host: "internal.example.com", path: "/x", expectedStatus: http.StatusOK, expectedPath: "/domain/x"},
+		{listener: "admin", path: "/internal/x", expectedStatus: http.StatusOK, expectedPath: "/admin/x"},
+		{listener: "admin", path: "/health", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.listener+" "+tc.host+tc.path, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, listeners[tc.listener].URL+tc.path, nil)
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedPath != "" && resp.Header.Get("X-Path") != tc.expectedPath {
+				t.Errorf("Expected upstream path %s, got %s", tc.expectedPath, resp.Header.Get("X-Path"))
+			}
+		})
+	}
+}
+
+func TestDomainPathRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Paths", strings.Join(r.Header.Values("X-Path"), ","))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Headers: map[string]*config.HeadersConfig{
+			"path_a": {Request: config.HeaderRulesConfig{Append: map[string]string{"X-Path": "a"}}},
+			"path_b": {Request: config.HeaderRulesConfig{Append: map[string]string{"X-Path": "b"}}},
+		},
+		Caches: map[string]*config.CacheConfig{
+			"cache_1": {TTL: time.Minute, MaxSize: 1 << 20, MaxEntrySize: 1 << 10},
+		},
+		DomainRoutes: []*config.DomainRouteConfig{{
+			Domain:      "example.com",
+			ProxyTarget: backend.URL,
+			Middleware:  []string{"cache_1"},
+			Paths: []*config.DomainPathConfig{
+				{Path: "/files/:name", Method: "GET", Middleware: []string{"path_a"}},
+				{Path: "/status", Method: "GET", Middleware: []string{"path_a"}},
+				{Path: "/status", Method: "GET", Middleware: []string{"path_b"}},
+			},
+		}},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		expectedPaths string
+		expectedCache string
+	}{
+		{name: "colon is not a wildcard", method: "GET", path: "/files/:name", expectedPaths: "a", expectedCache: "MISS"},
+		{name: "path not defined", method: "GET", path: "/files/readme", expectedPaths: "", expectedCache: "MISS"},
+		{name: "path defined twice", method: "GET", path: "/status", expectedPaths: "a,b", expectedCache: "MISS"},
+		{name: "other method", method: "POST", path: "/status", expectedPaths: "", expectedCache: "BYPASS"},
+		{name: "domain middleware wraps the proxy", method: "GET", path: "/status", expectedPaths: "a,b", expectedCache: "HIT"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, gateway.URL+tc.path, nil)
+			req.Host = "example.com"
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+			if actual := resp.Header.Get("X-Paths"); actual != tc.expectedPaths {
+				t.Errorf("Expected the middleware of paths %q to run, got %q", tc.expectedPaths, actual)
+			}
+			if actual := resp.Header.Get("X-Cache"); actual != tc.expectedCache {
+				t.Errorf("Expected X-Cache %s, got %s", tc.expectedCache, actual)
+			}
+		})
+	}
+}
+
+func TestIPFilterSharing(t *testing.T) {
+	allowFile := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(allowFile, []byte("10.0.0.0/8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newCfg := func(references int) *config.Config {
+		cfg := &config.Config{
+			IPFilters: map[string]*config.IPFilterConfig{
+				"office": {AllowFile: allowFile, ReloadInterval: time.Hour, RejectStatus: http.StatusForbidden},
+			},
+		}
+		for i := 0; i < references; i++ {
+			cfg.Routes = append(cfg.Routes, &config.RouteConfig{
+				Prefix:      fmt.Sprintf("/route%d", i),
+				Method:      "GET",
+				ProxyTarget: "http://localhost:8080",
+				Middleware:  []string{"office"},
+			})
+		}
+		return cfg
+	}
+
+	// Every ip list backed by a file has a goroutine watching it
+	watchers := func(references int) int {
+		before := runtime.NumGoroutine()
+		rr := &RouteRegistry{}
+		rr.FromConfig(newCfg(references))
+		return runtime.NumGoroutine() - before
+	}
+
+	if actual := watchers(1); actual != 1 {
+		t.Fatalf("Expected 1 watcher for a single reference, got %d", actual)
+	}
+	if actual := watchers(3); actual != 1 {
+		t.Errorf("Expected the references of a filter to share its watcher, got %d watchers", actual)
+	}
+}
+
+func TestDomainRouteHeaderHooks(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	domainRoute := func(domain string, paths ...*config.DomainPathConfig) *config.DomainRouteConfig {
+		return &config.DomainRouteConfig{
+			Domain:      domain,
+			ProxyTarget: backend.URL,
+			Middleware:  []string{"cors_1", "added"},
+			Paths:       paths,
+		}
+	}
+
+	cfg := &config.Config{
+		CORS: map[string]*config.CORSConfig{"cors_1": {AllowOrigins: []string{"*"}}},
+		Headers: map[string]*config.HeadersConfig{
+			"added": {Response: config.HeaderRulesConfig{Set: map[string]string{"X-Added": "yes"}}},
+		},
+		DomainRoutes: []*config.DomainRouteConfig{
+			domainRoute("plain.com"),
+			domainRoute("literal.com", &config.DomainPathConfig{Path: "/empty", Method: "GET"}),
+			domainRoute("pattern.com", &config.DomainPathConfig{Path: "/{name}", Method: "GET"}),
+		},
+	}
+
+	rr := &RouteRegistry{}
+	rr.FromConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rr.RegisterRoutes(r)
+	rr.RegisterDomainRoutes(r)
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	// Responses without a body get the headers of the domain middleware too
+	for _, host := range []string{"plain.com", "literal.com", "pattern.com"} {
+		t.Run(host, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+"/empty", nil)
+			req.Host = host
+			req.Header.Set("Origin", "https://app.com")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+			}
+			if actual := resp.Header.Get("Access-Control-Allow-Origin"); actual != "*" {
+				t.Errorf("Expected Access-Control-Allow-Origin: *, got %q", actual)
+			}
+			if actual := resp.Header.Get("X-Added"); actual != "yes" {
+				t.Errorf("Expected X-Added: yes, got %q", actual)
+			}
+		})
+	}
+}
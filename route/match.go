@@ -0,0 +1,107 @@
+package route
+
+import (
+	"net/http"
+	"net/netip"
+	"regexp"
+)
+
+// MatchRule requires a request value to be equal to Equals or to match Regex.
+// With neither set the value only has to be present.
+type MatchRule struct {
+	Name   string
+	Equals string
+	Regex  *regexp.Regexp
+}
+
+func (r MatchRule) matches(values []string) bool {
+	for _, v := range values {
+		switch {
+		case r.Regex != nil:
+			if r.Regex.MatchString(v) {
+				return true
+			}
+		case r.Equals != "":
+			if v == r.Equals {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Match holds the predicates a request must all satisfy to be served by a
+// route. A nil Match is satisfied by every request.
+type Match struct {
+	Headers     []MatchRule
+	Query       []MatchRule
+	Cookies     []MatchRule
+	ClientCIDRs []netip.Prefix
+}
+
+// And returns a Match satisfied by the requests satisfying both m and other
+func (m *Match) And(other *Match) *Match {
+	if m == nil {
+		return other
+	}
+	if other == nil {
+		return m
+	}
+
+	return &Match{
+		Headers:     append(append([]MatchRule{}, m.Headers...), other.Headers...),
+		Query:       append(append([]MatchRule{}, m.Query...), other.Query...),
+		Cookies:     append(append([]MatchRule{}, m.Cookies...), other.Cookies...),
+		ClientCIDRs: append(append([]netip.Prefix{}, m.ClientCIDRs...), other.ClientCIDRs...),
+	}
+}
+
+func (m *Match) Matches(req *http.Request, clientIP string) bool {
+	if m == nil {
+		return true
+	}
+
+	for _, rule := range m.Headers {
+		if !rule.matches(req.Header.Values(rule.Name)) {
+			return false
+		}
+	}
+
+	if len(m.Query) != 0 {
+		query := req.URL.Query()
+		for _, rule := range m.Query {
+			if !rule.matches(query[rule.Name]) {
+				return false
+			}
+		}
+	}
+
+	for _, rule := range m.Cookies {
+		var values []string
+		for _, cookie := range req.CookiesNamed(rule.Name) {
+			values = append(values, cookie.Value)
+		}
+		if !rule.matches(values) {
+			return false
+		}
+	}
+
+	if len(m.ClientCIDRs) != 0 {
+		addr, err := netip.ParseAddr(clientIP)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+
+		for _, prefix := range m.ClientCIDRs {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
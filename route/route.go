@@ -1,19 +1,117 @@
 package route
 
 import (
+	"cloud_gateway/pattern"
+	"cloud_gateway/upstream"
+	"path"
+	"regexp"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
+// rewriteParam matches the path parameters referenced in rewrite rules, e.g.
+// "{param.id}"
+var rewriteParam = regexp.MustCompile(`\{param\.([A-Za-z0-9_]+)\}`)
+
+// Rewrite holds the rules that turn the request path into the upstream path.
+// They apply in a fixed order: strip prefix, regex replace, add prefix.
+type Rewrite struct {
+	StripPrefix string
+	AddPrefix   string
+	Regex       *regexp.Regexp
+	Replacement string
+	// PreservePrefix forwards the part of the path matched by the route prefix
+	PreservePrefix bool
+}
+
+// Apply rewrites p, "{param.<name>}" in the added prefix and the replacement is
+// substituted with the value of the path parameter
+func (rw *Rewrite) Apply(p string, params gin.Params) string {
+	if rw == nil {
+		return p
+	}
+
+	// Only whole segments are stripped, "/api" leaves "/apis" untouched
+	if prefix := strings.TrimSuffix(rw.StripPrefix, "/"); prefix != "" {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			p = strings.TrimPrefix(p, prefix)
+		}
+	}
+
+	if rw.Regex != nil {
+		// "$" in parameter values must not be expanded as a submatch
+		replacement := substituteParams(rw.Replacement, params, func(v string) string {
+			return strings.ReplaceAll(v, "$", "$$")
+		})
+		p = rw.Regex.ReplaceAllString(p, replacement)
+	}
+
+	addPrefix := substituteParams(rw.AddPrefix, params, func(v string) string { return v })
+	if prefix := strings.TrimSuffix(addPrefix, "/"); prefix != "" {
+		p = prefix + "/" + strings.TrimPrefix(p, "/")
+	}
+
+	return p
+}
+
+func substituteParams(s string, params gin.Params, escape func(string) string) string {
+	if len(params) == 0 {
+		return s
+	}
+	return rewriteParam.ReplaceAllStringFunc(s, func(match string) string {
+		value, ok := params.Get(rewriteParam.FindStringSubmatch(match)[1])
+		if !ok {
+			return match
+		}
+		return escape(value)
+	})
+}
+
+// CleanPath removes duplicate slashes and dot segments of an upstream path,
+// a trailing slash is kept
+func CleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
 type Route struct {
 	Method       string
 	Prefix       string
 	RelativePath string
 	Middleware   []gin.HandlerFunc
+	// MiddlewareNames are the names of Middleware in the config, in order
+	MiddlewareNames []string
 	// optional fields
 	ProxyTarget    string
 	RedirectTarget string
 	RedirectCode   int
 	FixedPath      string
+	// Preflight registers the route for OPTIONS too, so that its middleware
+	// can answer CORS preflight requests
+	Preflight bool
+	Rewrite   *Rewrite
+	// Pattern is set for routes whose path has parameters, regex constraints
+	// or globs. RelativePath is then the router path of the pattern.
+	Pattern *pattern.Pattern
+	// Match restricts the route to the requests satisfying its predicates,
+	// routes sharing a path are tried in order
+	Match *Match
+	// Balancer replaces ProxyTarget for routes with weighted targets
+	Balancer  *upstream.Balancer
+	Mirror    *upstream.Mirror
+	WebSocket *upstream.WebSocket
+	// GRPCWeb translates gRPC-Web calls to gRPC towards the upstream
+	GRPCWeb bool
+	// Listeners serving the route, the default listener when empty
+	Listeners []string
 }
 
 func NewRoute(method, prefix, relativePath string, middleware []gin.HandlerFunc) Route {
@@ -41,10 +139,94 @@ func (r Route) WithFixedPath(fixedPath string) Route {
 	return r
 }
 
+func (r Route) WithPreflight() Route {
+	r.Preflight = true
+	return r
+}
+
+func (r Route) WithRewrite(rewrite *Rewrite) Route {
+	r.Rewrite = rewrite
+	return r
+}
+
+func (r Route) WithPattern(p *pattern.Pattern) Route {
+	r.Pattern = p
+	return r
+}
+
+func (r Route) WithMatch(match *Match) Route {
+	r.Match = match
+	return r
+}
+
+func (r Route) WithBalancer(balancer *upstream.Balancer) Route {
+	r.Balancer = balancer
+	return r
+}
+
+func (r Route) WithMirror(mirror *upstream.Mirror) Route {
+	r.Mirror = mirror
+	return r
+}
+
+func (r Route) WithWebSocket(ws *upstream.WebSocket) Route {
+	r.WebSocket = ws
+	return r
+}
+
+func (r Route) WithGRPCWeb(grpcWeb bool) Route {
+	r.GRPCWeb = grpcWeb
+	return r
+}
+
+func (r Route) WithMiddlewareNames(names []string) Route {
+	r.MiddlewareNames = names
+	return r
+}
+
+func (r Route) WithListeners(listeners []string) Route {
+	r.Listeners = listeners
+	return r
+}
+
+// Target returns the upstream of a request, picked by the balancer for routes
+// with weighted targets
+func (r Route) Target(c *gin.Context) string {
+	if r.Balancer != nil {
+		return r.Balancer.Target(c)
+	}
+	return r.ProxyTarget
+}
+
+// TargetPath returns the upstream path of a request. By default the part
+// matched by the route prefix is dropped, so a request to "/api/users" on the
+// prefix "/api" is forwarded to "/users". The wildcard is the part of the path
+// matched after the prefix and fixed path, a trailing slash is only kept when
+// the client sent one past the fixed path.
+func (r Route) TargetPath(requestPath, wildcard string, params gin.Params) string {
+	p := r.FixedPath + wildcard
+	if wildcard == "" || wildcard == "/" {
+		p = strings.TrimSuffix(r.FixedPath, "/")
+	}
+	if r.Pattern != nil {
+		// The fixed path is the pattern itself, only the prefix is literal
+		p = strings.TrimPrefix(requestPath, strings.TrimSuffix(r.Prefix, "/"))
+	}
+	if r.Rewrite != nil && r.Rewrite.PreservePrefix {
+		p = requestPath
+	}
+
+	return CleanPath(r.Rewrite.Apply(p, params))
+}
+
 type DomainPath struct {
 	Path       string
 	Method     string
 	Middleware []gin.HandlerFunc
+	// Rewrite replaces the rewrite of the domain route when set
+	Rewrite         *Rewrite
+	Pattern         *pattern.Pattern
+	MiddlewareNames []string
 }
 
 func NewDomainPath(path, method string, middleware []gin.HandlerFunc) DomainPath {
@@ -55,12 +237,34 @@ func NewDomainPath(path, method string, middleware []gin.HandlerFunc) DomainPath
 	}
 }
 
+func (dp DomainPath) WithRewrite(rewrite *Rewrite) DomainPath {
+	dp.Rewrite = rewrite
+	return dp
+}
+
+func (dp DomainPath) WithPattern(p *pattern.Pattern) DomainPath {
+	dp.Pattern = p
+	return dp
+}
+
+func (dp DomainPath) WithMiddlewareNames(names []string) DomainPath {
+	dp.MiddlewareNames = names
+	return dp
+}
+
 type DomainRoute struct {
-	Domain      string
-	ProxyTarget string
-	Middleware  []gin.HandlerFunc
+	Domain          string
+	ProxyTarget     string
+	Middleware      []gin.HandlerFunc
+	MiddlewareNames []string
 	// optional fields
-	Paths []DomainPath
+	Paths     []DomainPath
+	Rewrite   *Rewrite
+	Match     *Match
+	Balancer  *upstream.Balancer
+	WebSocket *upstream.WebSocket
+	GRPCWeb   bool
+	Listeners []string
 }
 
 func NewDomainRoute(domain, proxyTarget string, middleware []gin.HandlerFunc) DomainRoute {
@@ -75,3 +279,47 @@ func (dr DomainRoute) WithPaths(paths []DomainPath) DomainRoute {
 	dr.Paths = paths
 	return dr
 }
+
+func (dr DomainRoute) WithRewrite(rewrite *Rewrite) DomainRoute {
+	dr.Rewrite = rewrite
+	return dr
+}
+
+func (dr DomainRoute) WithMatch(match *Match) DomainRoute {
+	dr.Match = match
+	return dr
+}
+
+func (dr DomainRoute) WithBalancer(balancer *upstream.Balancer) DomainRoute {
+	dr.Balancer = balancer
+	return dr
+}
+
+func (dr DomainRoute) WithWebSocket(ws *upstream.WebSocket) DomainRoute {
+	dr.WebSocket = ws
+	return dr
+}
+
+func (dr DomainRoute) WithGRPCWeb(grpcWeb bool) DomainRoute {
+	dr.GRPCWeb = grpcWeb
+	return dr
+}
+
+func (dr DomainRoute) WithMiddlewareNames(names []string) DomainRoute {
+	dr.MiddlewareNames = names
+	return dr
+}
+
+func (dr DomainRoute) WithListeners(listeners []string) DomainRoute {
+	dr.Listeners = listeners
+	return dr
+}
+
+// Target returns the upstream of a request, picked by the balancer for domain
+// routes with weighted targets
+func (dr DomainRoute) Target(c *gin.Context) string {
+	if dr.Balancer != nil {
+		return dr.Balancer.Target(c)
+	}
+	return dr.ProxyTarget
+}
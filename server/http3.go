@@ -0,0 +1,48 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// AltSvc advertises the HTTP/3 listener on port in the responses of the TCP
+// listeners, clients switch to QUIC for their next requests
+func AltSvc(port int) gin.HandlerFunc {
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+
+	return func(c *gin.Context) {
+		if c.Request.ProtoMajor < 3 {
+			c.Header("Alt-Svc", altSvc)
+		}
+		c.Next()
+	}
+}
+
+// ListenHTTP3 serves handler over QUIC on the udp address addr with the
+// certificate of the TLS listener
+func ListenHTTP3(addr, certFile, keyFile string, handler http.Handler) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeHTTP3(conn, cert, handler)
+}
+
+// ServeHTTP3 serves handler over QUIC on conn until it is closed
+func ServeHTTP3(conn net.PacketConn, cert tls.Certificate, handler http.Handler) error {
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+	return srv.Serve(conn)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func newEngine(port int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AltSvc(port))
+	r.GET("/hello", func(c *gin.Context) {
+		c.String(http.StatusOK, "%s", c.Request.Proto)
+	})
+	return r
+}
+
+func TestAltSvc(t *testing.T) {
+	r := newEngine(8443)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if got := w.Header().Get("Alt-Svc"); got != `h3=":8443"; ma=86400` {
+		t.Errorf("Alt-Svc = %q, expected h3 on port 8443", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/3.0", 3, 0
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("Alt-Svc = %q on HTTP/3 response, expected none", got)
+	}
+}
+
+func TestServeHTTP3(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	go ServeHTTP3(conn, cert, newEngine(port))
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err := client.Get("https://" + conn.LocalAddr().String() + "/hello")
+	if err != nil {
+		t.Fatalf("HTTP/3 request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 3 || string(body) != "HTTP/3.0" {
+		t.Errorf("got %s with body %q, expected an HTTP/3 response", resp.Proto, body)
+	}
+	if got := resp.Header.Get("Alt-Svc"); got != "" {
+		t.Errorf("Alt-Svc = %q on HTTP/3 response, expected none", got)
+	}
+}
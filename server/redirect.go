@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RedirectHTTPS returns the handler of listeners that redirect every request
+// to the same host and URI over https on port. The port is left out of the
+// location when it is 443.
+func RedirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			// IPv6 addresses keep their brackets without a port
+			host = "[" + host + "]"
+		}
+
+		// Only GET and HEAD requests may be turned into GET by a 301, the
+		// others keep their method and body with a 308
+		code := http.StatusPermanentRedirect
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
+	})
+}
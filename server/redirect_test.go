@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		port     int
+		code     int
+		location string
+	}{
+		{
+			name:     "default https port",
+			method:   http.MethodGet,
+			url:      "http://example.com/api/users?page=2",
+			port:     443,
+			code:     http.StatusMovedPermanently,
+			location: "https://example.com/api/users?page=2",
+		},
+		{
+			name:     "custom https port",
+			method:   http.MethodHead,
+			url:      "http://example.com:8080/",
+			port:     8443,
+			code:     http.StatusMovedPermanently,
+			location: "https://example.com:8443/",
+		},
+		{
+			name:     "post keeps its method",
+			method:   http.MethodPost,
+			url:      "http://example.com:80/api/users",
+			port:     443,
+			code:     http.StatusPermanentRedirect,
+			location: "https://example.com/api/users",
+		},
+		{
+			name:     "ipv6 host",
+			method:   http.MethodGet,
+			url:      "http://[::1]:8080/health",
+			port:     443,
+			code:     http.StatusMovedPermanently,
+			location: "https://[::1]/health",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RedirectHTTPS(tc.port).ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+
+			if w.Code != tc.code || w.Header().Get("Location") != tc.location {
+				t.Errorf("got %d to %q, expected %d to %q", w.Code, w.Header().Get("Location"), tc.code, tc.location)
+			}
+		})
+	}
+}
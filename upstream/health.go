@@ -0,0 +1,127 @@
+package upstream
+
+import (
+	"cloud_gateway/metrics"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HealthCheck probes every target of a balancer at an interval. A target is
+// taken out after UnhealthyThreshold failed probes in a row and put back after
+// HealthyThreshold successful ones.
+type HealthCheck struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// StartHealthChecks probes the targets of the balancer in the background,
+// targets added by a reload are probed from the next interval on
+func (b *Balancer) StartHealthChecks(hc HealthCheck) {
+	b.healthChecked.Store(true)
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	// Consecutive results of the same kind by target url, positive for
+	// successes and negative for failures
+	streaks := make(map[string]int)
+
+	go func() {
+		ticker := time.NewTicker(hc.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+
+			for _, state := range *b.targets.Load() {
+				healthy := probe(client, strings.TrimSuffix(state.URL, "/")+hc.Path, hc.Timeout)
+
+				streak := streaks[state.URL]
+				switch {
+				case healthy && streak >= 0:
+					streak++
+				case healthy:
+					streak = 1
+				case streak <= 0:
+					streak--
+				default:
+					streak = -1
+				}
+				streaks[state.URL] = streak
+
+				if !state.healthy.Load() && streak >= hc.HealthyThreshold {
+					b.setHealthy(state, true)
+				} else if state.healthy.Load() && -streak >= hc.UnhealthyThreshold {
+					b.setHealthy(state, false)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the health checks of a balancer that is not used anymore. Its
+// healthy targets are taken off the gauge, the balancer replacing it reports
+// them again.
+func (b *Balancer) Stop() {
+	b.stopOnce.Do(func() {
+		b.healthMu.Lock()
+		defer b.healthMu.Unlock()
+
+		close(b.stop)
+		for _, state := range *b.targets.Load() {
+			if state.healthy.Load() {
+				metrics.AddGauge("gateway_upstream_healthy", -1, "balancer", b.name, "target", state.URL)
+			}
+		}
+	})
+}
+
+func probe(client *http.Client, url string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+func (b *Balancer) setHealthy(state *targetState, healthy bool) {
+	b.healthMu.Lock()
+	defer b.healthMu.Unlock()
+
+	// A probe finishing after Stop must not report the target again
+	select {
+	case <-b.stop:
+		return
+	default:
+	}
+
+	state.healthy.Store(healthy)
+
+	if healthy {
+		log.Printf("[HEALTH] Target %s of %s is healthy again", state.URL, b.name)
+		metrics.AddGauge("gateway_upstream_healthy", 1, "balancer", b.name, "target", state.URL)
+		return
+	}
+	log.Printf("[HEALTH] Target %s of %s is unhealthy, its clients fail over to other targets", state.URL, b.name)
+	metrics.AddGauge("gateway_upstream_healthy", -1, "balancer", b.name, "target", state.URL)
+}
@@ -0,0 +1,156 @@
+package upstream
+
+import (
+	"bytes"
+	"cloud_gateway/grpc"
+	"cloud_gateway/metrics"
+	"context"
+	"io"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MirrorMatch    = "match"
+	MirrorMismatch = "mismatch"
+	MirrorError    = "error"
+	MirrorSkipped  = "skipped"
+)
+
+// hopHeaders are not forwarded to the mirror, like the reverse proxy does not
+// forward them to the primary target
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Mirror sends a copy of the requests of a route to a secondary target once
+// the primary target has answered, the mirror response is discarded and only
+// compared by status
+type Mirror struct {
+	Target      string
+	Percentage  float64
+	MaxBodySize int64
+	Timeout     time.Duration
+	client      *http.Client
+}
+
+func NewMirror(target string, percentage float64, maxBodySize int64, timeout time.Duration) *Mirror {
+	return &Mirror{
+		Target:      target,
+		Percentage:  percentage,
+		MaxBodySize: maxBodySize,
+		Timeout:     timeout,
+		client: &http.Client{
+			// Redirects are compared, not followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// teeBody keeps a copy of the body read by the primary request, up to a limit
+type teeBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	tooLarge bool
+	eof      bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.tooLarge {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.tooLarge = true
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (m *Mirror) record(result string) {
+	metrics.IncCounter("gateway_mirror_requests_total", "mirror", m.Target, "result", result)
+}
+
+// Serve runs proxy for the primary target and then mirrors the request to
+// targetPath on the mirror target in the background. The body is copied while
+// the primary request reads it, so the primary path never waits on the mirror.
+func (m *Mirror) Serve(c *gin.Context, targetPath string, proxy func()) {
+	// Upgraded connections and gRPC calls cannot be replayed
+	if IsWebSocket(c.Request) || grpc.IsCall(c.Request) || mathrand.Float64()*100 >= m.Percentage {
+		proxy()
+		return
+	}
+
+	if c.Request.ContentLength > m.MaxBodySize {
+		m.record(MirrorSkipped)
+		proxy()
+		return
+	}
+
+	var body *teeBody
+	if c.Request.Body != nil && c.Request.Body != http.NoBody && c.Request.ContentLength != 0 {
+		body = &teeBody{ReadCloser: c.Request.Body, limit: m.MaxBodySize}
+		c.Request.Body = body
+	}
+
+	proxy()
+
+	// Mirroring a partial body would replay a different request
+	if body != nil && (body.tooLarge || !body.eof && int64(body.buf.Len()) != c.Request.ContentLength) {
+		m.record(MirrorSkipped)
+		return
+	}
+
+	req, err := http.NewRequest(c.Request.Method, strings.TrimSuffix(m.Target, "/")+targetPath, nil)
+	if err != nil {
+		log.Printf("[MIRROR] Invalid mirror request to %s: %v", m.Target, err)
+		m.record(MirrorError)
+		return
+	}
+	req.URL.RawQuery = c.Request.URL.RawQuery
+	req.Header = c.Request.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set("X-Forwarded-Host", c.Request.Host)
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body.buf.Bytes()))
+		req.ContentLength = int64(body.buf.Len())
+	}
+
+	go m.send(req, c.Writer.Status())
+}
+
+func (m *Mirror) send(req *http.Request, primaryStatus int) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Printf("[MIRROR] Mirror request to %s failed: %v", req.URL, err)
+		m.record(MirrorError)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != primaryStatus {
+		log.Printf("[MIRROR] Status of %s %s differs, primary %d, mirror %d", req.Method, req.URL, primaryStatus, resp.StatusCode)
+		m.record(MirrorMismatch)
+		return
+	}
+	m.record(MirrorMatch)
+}
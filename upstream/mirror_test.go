@@ -0,0 +1,113 @@
+package upstream
+
+import (
+	"cloud_gateway/metrics"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mirroredRequest struct {
+	uri  string
+	body string
+}
+
+func TestMirror(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		maxBodySize    int64
+		mirrorStatus   int
+		expectMirror   bool
+		expectedResult string
+	}{
+		{name: "mirrored with body", body: `{"id":1}`, maxBodySize: 1024, mirrorStatus: http.StatusCreated, expectMirror: true, expectedResult: MirrorMatch},
+		{name: "status mismatch", body: `{"id":1}`, maxBodySize: 1024, mirrorStatus: http.StatusInternalServerError, expectMirror: true, expectedResult: MirrorMismatch},
+		{name: "body too large", body: strings.Repeat("a", 64), maxBodySize: 16, expectedResult: MirrorSkipped},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received := make(chan mirroredRequest, 1)
+			mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.WriteHeader(tc.mirrorStatus)
+				received <- mirroredRequest{uri: r.URL.RequestURI(), body: string(body)}
+			}))
+			defer mirrorServer.Close()
+
+			m := NewMirror(mirrorServer.URL, 100, tc.maxBodySize, time.Second)
+			before := metrics.Value("gateway_mirror_requests_total", "mirror", m.Target, "result", tc.expectedResult)
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			var primaryBody string
+			r.POST("/items", func(c *gin.Context) {
+				m.Serve(c, "/v2/items", func() {
+					body, _ := io.ReadAll(c.Request.Body)
+					primaryBody = string(body)
+					c.Status(http.StatusCreated)
+				})
+			})
+
+			req := httptest.NewRequest("POST", "/items?dry=1", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if primaryBody != tc.body {
+				t.Fatalf("Expected the primary to read the whole body, got %q", primaryBody)
+			}
+
+			if tc.expectMirror {
+				select {
+				case mr := <-received:
+					if mr.uri != "/v2/items?dry=1" || mr.body != tc.body {
+						t.Errorf("Expected the mirror to receive the request, got %s with body %q", mr.uri, mr.body)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("The request was not mirrored")
+				}
+			}
+
+			// The result is recorded once the mirror response is read
+			deadline := time.Now().Add(time.Second)
+			for metrics.Value("gateway_mirror_requests_total", "mirror", m.Target, "result", tc.expectedResult) == before {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected a mirror result %q", tc.expectedResult)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestMirrorSampling(t *testing.T) {
+	mirrored := make(chan struct{}, 1)
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- struct{}{}
+	}))
+	defer mirrorServer.Close()
+
+	// A percentage this low samples practically no request
+	m := NewMirror(mirrorServer.URL, 0.0000001, 1024, time.Second)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/items", func(c *gin.Context) {
+		m.Serve(c, "/items", func() { c.Status(http.StatusOK) })
+	})
+	for i := 0; i < 100; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+	}
+
+	select {
+	case <-mirrored:
+		t.Fatal("Expected requests outside the sampling percentage not to be mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
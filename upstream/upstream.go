@@ -0,0 +1,294 @@
+package upstream
+
+import (
+	"cloud_gateway/metrics"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Target struct {
+	URL    string
+	Weight int
+}
+
+// targetState is a target together with its health, which is kept when the
+// targets are reloaded
+type targetState struct {
+	Target
+	// id names the target in affinity cookies without revealing its url
+	id      string
+	healthy atomic.Bool
+}
+
+func targetID(url string) string {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Balancer splits the requests of a route between its targets in proportion
+// to their weights, skipping unhealthy targets. The targets can be replaced
+// while requests are served.
+type Balancer struct {
+	name    string
+	sticky  *Sticky
+	targets atomic.Pointer[[]*targetState]
+	// healthChecked is set once the targets are probed, before that all of
+	// them count as healthy
+	healthChecked atomic.Bool
+	// stop ends the health checks once the balancer is replaced
+	stop     chan struct{}
+	stopOnce sync.Once
+	// healthMu orders the updates of the gateway_upstream_healthy gauge
+	healthMu sync.Mutex
+}
+
+func NewBalancer(name string, targets []Target, sticky *Sticky) *Balancer {
+	b := &Balancer{name: name, sticky: sticky, stop: make(chan struct{})}
+	b.SetTargets(targets)
+	return b
+}
+
+func (b *Balancer) SetTargets(targets []Target) {
+	b.healthMu.Lock()
+	defer b.healthMu.Unlock()
+
+	current := make(map[string]*targetState)
+	if states := b.targets.Load(); states != nil {
+		for _, state := range *states {
+			current[state.URL] = state
+		}
+	}
+
+	states := make([]*targetState, 0, len(targets))
+	for _, t := range targets {
+		state := &targetState{Target: t, id: targetID(t.URL)}
+		if previous, ok := current[t.URL]; ok {
+			state.healthy.Store(previous.healthy.Load())
+		} else {
+			state.healthy.Store(true)
+			metrics.AddGauge("gateway_upstream_healthy", 1, "balancer", b.name, "target", t.URL)
+		}
+		states = append(states, state)
+	}
+
+	// Targets removed by a reload are no longer reported
+	for url, state := range current {
+		if !containsURL(targets, url) && state.healthy.Load() {
+			metrics.AddGauge("gateway_upstream_healthy", -1, "balancer", b.name, "target", url)
+		}
+	}
+
+	b.targets.Store(&states)
+}
+
+func containsURL(targets []Target, url string) bool {
+	for _, t := range targets {
+		if t.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Balancer) Targets() []Target {
+	var targets []Target
+	for _, state := range *b.targets.Load() {
+		targets = append(targets, state.Target)
+	}
+	return targets
+}
+
+// TargetStatus is a target together with its health
+type TargetStatus struct {
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Healthy bool   `json:"healthy"`
+}
+
+// Status returns the targets of the balancer with their health
+func (b *Balancer) Status() []TargetStatus {
+	var status []TargetStatus
+	for _, state := range *b.targets.Load() {
+		status = append(status, TargetStatus{URL: state.URL, Weight: state.Weight, Healthy: state.healthy.Load()})
+	}
+	return status
+}
+
+// HealthChecked reports whether the targets of the balancer are probed
+func (b *Balancer) HealthChecked() bool {
+	return b.healthChecked.Load()
+}
+
+// available returns the targets that can take requests: the healthy ones with
+// a weight, or every target with a weight when none is healthy
+func (b *Balancer) available() []*targetState {
+	var healthy, weighted []*targetState
+	for _, state := range *b.targets.Load() {
+		if state.Weight <= 0 {
+			continue
+		}
+		weighted = append(weighted, state)
+		if state.healthy.Load() {
+			healthy = append(healthy, state)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return weighted
+	}
+	return healthy
+}
+
+// pick returns a target for key by weighted rendezvous hashing. Requests with
+// the same non empty key get the same target, and a change of weights or
+// health only moves the keys needed to honor it. Without key the target is
+// chosen at random by weight.
+func (b *Balancer) pick(key string) *targetState {
+	available := b.available()
+	if len(available) == 0 {
+		return nil
+	}
+
+	if key == "" {
+		total := 0
+		for _, state := range available {
+			total += state.Weight
+		}
+		n := mathrand.IntN(total)
+		for _, state := range available {
+			if n < state.Weight {
+				return state
+			}
+			n -= state.Weight
+		}
+		return available[len(available)-1]
+	}
+
+	var best *targetState
+	bestScore := math.Inf(-1)
+	for _, state := range available {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(state.id))
+		// Maps the hash into (0, 1)
+		u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(state.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = state, score
+		}
+	}
+	return best
+}
+
+// Pick returns the url of a target for key
+func (b *Balancer) Pick(key string) string {
+	if state := b.pick(key); state != nil {
+		return state.URL
+	}
+	return ""
+}
+
+// Target returns the url of the target serving the request, the same one for
+// every request of a client while it is healthy when the balancer is sticky
+func (b *Balancer) Target(c *gin.Context) string {
+	var state *targetState
+	if b.sticky != nil && b.sticky.Cookie != "" {
+		state = b.pinned(c)
+	} else {
+		state = b.pick(b.sticky.Key(c))
+	}
+
+	if state == nil {
+		return ""
+	}
+	metrics.IncCounter("gateway_upstream_requests_total", "balancer", b.name, "target", state.URL)
+	return state.URL
+}
+
+// pinned returns the target named by the affinity cookie of the gateway. A
+// client without cookie, or pinned to a target that is unhealthy or no longer
+// weighted, is assigned a new target and the cookie is issued again.
+func (b *Balancer) pinned(c *gin.Context) *targetState {
+	available := b.available()
+	if id, err := c.Cookie(b.sticky.Cookie); err == nil {
+		for _, state := range available {
+			if state.id == id {
+				return state
+			}
+		}
+	}
+
+	state := b.pick("")
+	if state != nil {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     b.sticky.Cookie,
+			Value:    state.id,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return state
+}
+
+// Sticky selects how clients are kept on the same target. Cookie is issued by
+// the gateway and names the target, while HashCookie, Header and ClientIP are
+// hashed, so that clients move to another target only when theirs fails.
+type Sticky struct {
+	Cookie     string
+	HashCookie string
+	Header     string
+	ClientIP   bool
+}
+
+// Key returns the value hashed to assign the request to a target
+func (s *Sticky) Key(c *gin.Context) string {
+	switch {
+	case s == nil:
+		return ""
+	case s.HashCookie != "":
+		key, _ := c.Cookie(s.HashCookie)
+		return key
+	case s.Header != "":
+		return c.GetHeader(s.Header)
+	case s.ClientIP:
+		return c.ClientIP()
+	default:
+		return ""
+	}
+}
+
+var (
+	balancers   = make(map[string]*Balancer)
+	balancersMu sync.Mutex
+)
+
+// Register makes b the balancer found under name by reloads of the targets.
+// The balancer of a previous parse of the config registered under the same
+// name is stopped.
+func Register(name string, b *Balancer) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	if previous, ok := balancers[name]; ok && previous != b {
+		previous.Stop()
+	}
+	balancers[name] = b
+}
+
+// Lookup returns the balancer registered under name
+func Lookup(name string) (*Balancer, bool) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	b, ok := balancers[name]
+	return b, ok
+}
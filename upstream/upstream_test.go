@@ -0,0 +1,198 @@
+package upstream
+
+import (
+	"cloud_gateway/metrics"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBalancerPick(t *testing.T) {
+	b := NewBalancer("test", []Target{{URL: "v1", Weight: 95}, {URL: "v2", Weight: 5}}, nil)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[b.Pick("")]++
+	}
+	if counts["v2"] < 300 || counts["v2"] > 700 {
+		t.Errorf("Expected about 5%% of requests on v2, got %d of 10000", counts["v2"])
+	}
+
+	b.SetTargets([]Target{{URL: "v1", Weight: 0}, {URL: "v2", Weight: 1}})
+	for i := 0; i < 100; i++ {
+		if target := b.Pick(""); target != "v2" {
+			t.Fatalf("Expected targets with weight 0 to get no requests, got %s", target)
+		}
+	}
+}
+
+func TestBalancerStickyKeys(t *testing.T) {
+	b := NewBalancer("test", []Target{{URL: "v1", Weight: 90}, {URL: "v2", Weight: 10}}, nil)
+
+	assigned := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		assigned[key] = b.Pick(key)
+		if b.Pick(key) != assigned[key] {
+			t.Fatalf("Expected key %s to keep its target", key)
+		}
+	}
+
+	// Raising the share of v2 only moves keys from v1 to v2
+	b.SetTargets([]Target{{URL: "v1", Weight: 50}, {URL: "v2", Weight: 50}})
+	for key, target := range assigned {
+		if target == "v2" && b.Pick(key) != "v2" {
+			t.Fatalf("Expected key %s to stay on v2 after raising its weight", key)
+		}
+	}
+}
+
+func TestStickyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name        string
+		sticky      *Sticky
+		header      http.Header
+		expectedKey string
+	}{
+		{name: "not sticky", sticky: nil},
+		{name: "header", sticky: &Sticky{Header: "X-User-Id"}, header: http.Header{"X-User-Id": {"42"}}, expectedKey: "42"},
+		{name: "existing cookie", sticky: &Sticky{HashCookie: "session"}, header: http.Header{"Cookie": {"session=abc"}}, expectedKey: "abc"},
+		{name: "missing cookie", sticky: &Sticky{HashCookie: "session"}, expectedKey: ""},
+		{name: "client ip", sticky: &Sticky{ClientIP: true}, expectedKey: "192.0.2.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			for name, values := range tc.header {
+				c.Request.Header[name] = values
+			}
+
+			if key := tc.sticky.Key(c); key != tc.expectedKey {
+				t.Errorf("Expected key %q, got %q", tc.expectedKey, key)
+			}
+		})
+	}
+}
+
+func TestBalancerCookieAffinity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	b := NewBalancer("test", []Target{{URL: "a", Weight: 1}, {URL: "b", Weight: 1}}, &Sticky{Cookie: "affinity"})
+
+	target := func(cookie *http.Cookie) (string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			c.Request.AddCookie(cookie)
+		}
+		url := b.Target(c)
+
+		var issued *http.Cookie
+		for _, ck := range w.Result().Cookies() {
+			if ck.Name == "affinity" {
+				issued = ck
+			}
+		}
+		return url, issued
+	}
+
+	pinned, cookie := target(nil)
+	if cookie == nil {
+		t.Fatal("Expected the gateway to issue an affinity cookie")
+	}
+	for i := 0; i < 20; i++ {
+		if url, issued := target(cookie); url != pinned || issued != nil {
+			t.Fatalf("Expected the client to stay on %s without a new cookie, got %s", pinned, url)
+		}
+	}
+
+	// The pinned target fails, the client moves and gets a new cookie
+	for _, state := range *b.targets.Load() {
+		if state.URL == pinned {
+			b.setHealthy(state, false)
+		}
+	}
+	url, issued := target(cookie)
+	if url == pinned || issued == nil || issued.Value == cookie.Value {
+		t.Fatalf("Expected the client to fail over from %s with a new cookie, got %s", pinned, url)
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	b := NewBalancer("test", []Target{{URL: "a", Weight: 1}, {URL: "b", Weight: 1}, {URL: "c", Weight: 1}}, nil)
+
+	assigned := make(map[string]string)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("10.0.0.%d", i)
+		assigned[key] = b.Pick(key)
+	}
+
+	states := *b.targets.Load()
+	b.setHealthy(states[0], false)
+	for key, target := range assigned {
+		moved := b.Pick(key)
+		if target == "a" && moved == "a" {
+			t.Fatalf("Expected key %s to fail over from the unhealthy target", key)
+		}
+		if target != "a" && moved != target {
+			t.Fatalf("Expected key %s on a healthy target to stay on %s, got %s", key, target, moved)
+		}
+	}
+
+	// Clients are only sent to unhealthy targets when no target is healthy
+	b.setHealthy(states[1], false)
+	b.setHealthy(states[2], false)
+	if b.Pick("10.0.0.1") == "" {
+		t.Fatal("Expected a target when none is healthy")
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	b := NewBalancer("health", []Target{{URL: server.URL, Weight: 1}, {URL: "other", Weight: 1}}, nil)
+	b.StartHealthChecks(HealthCheck{Path: "/healthz", Interval: 5 * time.Millisecond, Timeout: time.Second, UnhealthyThreshold: 2, HealthyThreshold: 2})
+	state := (*b.targets.Load())[0]
+
+	waitFor := func(expected bool) {
+		deadline := time.Now().Add(time.Second)
+		for state.healthy.Load() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the target to become healthy=%v", expected)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor(false)
+	healthy.Store(true)
+	waitFor(true)
+}
+
+func TestHealthyGaugeAcrossReplacements(t *testing.T) {
+	targets := []Target{{URL: "http://a", Weight: 1}, {URL: "http://b", Weight: 1}}
+	for i := 0; i < 3; i++ {
+		Register("gauge", NewBalancer("gauge", targets, nil))
+	}
+
+	for _, target := range targets {
+		if healthy := metrics.Value("gateway_upstream_healthy", "balancer", "gauge", "target", target.URL); healthy != 1 {
+			t.Errorf("Expected target %s to be reported healthy once, got %d", target.URL, healthy)
+		}
+	}
+}
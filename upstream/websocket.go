@@ -0,0 +1,135 @@
+package upstream
+
+import (
+	"bufio"
+	"cloud_gateway/metrics"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsWebSocket reports whether req asks to upgrade the connection to WebSocket
+func IsWebSocket(req *http.Request) bool {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WebSocket limits the upgraded connections of a route. The upgrade itself is
+// done by the reverse proxy, which copies the frames between client and target
+// once the target has switched protocols.
+type WebSocket struct {
+	Name           string
+	MaxConnections int
+	IdleTimeout    time.Duration
+	MaxLifetime    time.Duration
+	open           atomic.Int64
+}
+
+func NewWebSocket(name string, maxConnections int, idleTimeout, maxLifetime time.Duration) *WebSocket {
+	return &WebSocket{
+		Name:           name,
+		MaxConnections: maxConnections,
+		IdleTimeout:    idleTimeout,
+		MaxLifetime:    maxLifetime,
+	}
+}
+
+// Serve runs proxy for WebSocket upgrade requests within the connection limit
+// and applies the timeouts to the connection once upgraded. Other requests are
+// proxied unchanged.
+func (ws *WebSocket) Serve(c *gin.Context, proxy func()) {
+	if ws == nil || !IsWebSocket(c.Request) {
+		proxy()
+		return
+	}
+
+	// The connection is counted from the upgrade request until it is closed
+	open := ws.open.Add(1)
+	defer ws.open.Add(-1)
+	if ws.MaxConnections > 0 && open > int64(ws.MaxConnections) {
+		metrics.IncCounter("gateway_websocket_rejected_total", "route", ws.Name)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "too many websocket connections"})
+		return
+	}
+
+	c.Writer = &webSocketWriter{ResponseWriter: c.Writer, ws: ws}
+	proxy()
+}
+
+// webSocketWriter hands the reverse proxy a connection enforcing the timeouts
+// of the route when it hijacks the client connection
+type webSocketWriter struct {
+	gin.ResponseWriter
+	ws *WebSocket
+}
+
+func (w *webSocketWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return newWebSocketConn(conn, w.ws), brw, nil
+}
+
+// webSocketConn closes the client connection when no frame went either way
+// for the idle timeout, or once it has been open for the max lifetime
+type webSocketConn struct {
+	net.Conn
+	ws        *WebSocket
+	lifetime  *time.Timer
+	closeOnce sync.Once
+}
+
+func newWebSocketConn(conn net.Conn, ws *WebSocket) *webSocketConn {
+	wc := &webSocketConn{Conn: conn, ws: ws}
+	if ws.MaxLifetime > 0 {
+		wc.lifetime = time.AfterFunc(ws.MaxLifetime, func() { wc.Close() })
+	}
+	metrics.AddGauge("gateway_websocket_connections", 1, "route", ws.Name)
+	return wc
+}
+
+func (wc *webSocketConn) touch() {
+	if wc.ws.IdleTimeout > 0 {
+		wc.Conn.SetDeadline(time.Now().Add(wc.ws.IdleTimeout))
+	}
+}
+
+func (wc *webSocketConn) Read(p []byte) (int, error) {
+	wc.touch()
+	n, err := wc.Conn.Read(p)
+	if n > 0 {
+		wc.touch()
+	}
+	return n, err
+}
+
+func (wc *webSocketConn) Write(p []byte) (int, error) {
+	wc.touch()
+	return wc.Conn.Write(p)
+}
+
+func (wc *webSocketConn) Close() error {
+	err := wc.Conn.Close()
+	wc.closeOnce.Do(func() {
+		if wc.lifetime != nil {
+			wc.lifetime.Stop()
+		}
+		metrics.AddGauge("gateway_websocket_connections", -1, "route", wc.ws.Name)
+	})
+	return err
+}